@@ -0,0 +1,11 @@
+name = "web"
+tags = { "env" = "dev" }
+
+vpc    = "main"
+subnet = "private"
+Foo {
+  bar = ""
+}
+port = 80
+
+owner = "ops"
@@ -0,0 +1,8 @@
+tags = { "env" = "dev" }
+name = "web"
+Foo {
+  bar = ""
+  baz = ""
+  Inner {
+  }
+}
@@ -0,0 +1,6 @@
+resource "aws_instance" "web" {
+  ami = "ami-123"
+}
+resource "aws_ebs_volume" "data" {
+  ami = ""
+}
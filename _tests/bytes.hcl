@@ -0,0 +1,11 @@
+default      = "aGVsbG8="
+utf8         = "hello"
+base64       = "aGVsbG8="
+base64decode = base64decode("aGVsbG8=")
+hex          = "68656c6c6f"
+map          = { "key" = "68656c6c6f" }
+empty        = ""
+array        = [1, 2]
+ip           = "10.0.0.1"
+ip_hex       = "0a000001"
+ips          = ["::1"]
@@ -0,0 +1,17 @@
+settings {
+  enabled = sensitive(true)
+  name    = "web"
+}
+ingress {
+  cidrs = ["10.0.0.0/8"]
+  port  = 80
+}
+ingress {
+  cidrs = ["10.0.0.0/8"]
+  port  = 443
+}
+egress "all" {
+  cidrs = ["10.0.0.0/8"]
+  port  = 0
+}
+rules = [{ "cidrs" = ["10.0.0.0/8"], "port" = 22 }]
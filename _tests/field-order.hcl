@@ -0,0 +1,6 @@
+count = 2
+Foo {
+  bar = ""
+}
+name = "web"
+tags = { "env" = "dev" }
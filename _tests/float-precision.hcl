@@ -0,0 +1,5 @@
+big_float   = 1234567890.10
+json_number = 0
+cty         = null
+float64     = -0.10
+float32     = 3.30
@@ -0,0 +1,29 @@
+array      = ["a", "b"]
+float32    = 0.1
+float32s   = [1.5, 3.3]
+interface  = [[1, 2], ["a"]]
+interfaces = [[true], null]
+array_disk {
+  size = 1
+}
+array_disk {
+  size = 2
+}
+nested_disk {
+  size = 3
+}
+nested_disk {
+  size = 4
+}
+nested_disk {
+  size = 5
+}
+mixed_disk {
+  size = 6
+}
+mixed_disk {
+  size = 7
+}
+mixed_disk {
+  size = 8
+}
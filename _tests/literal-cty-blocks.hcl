@@ -0,0 +1,6 @@
+secret {
+  password = sensitive("pa$${ss}")
+}
+ingress {
+  description = sensitive("%%{ if x }")
+}
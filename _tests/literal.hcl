@@ -0,0 +1,4 @@
+string     = "pa$${ss}"
+expression = "%%{ if true }pass%%{ endif }"
+cty        = { "$${key}" = "pa$${ss}" }
+template   = "pa${ss}"
@@ -0,0 +1,7 @@
+meta {
+  owner    = "ops"
+  replicas = 3
+  zones    = ["a", "b"]
+}
+env {
+}
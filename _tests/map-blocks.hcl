@@ -0,0 +1,11 @@
+resource "aws_ebs_volume" "data" {
+}
+resource "aws_instance" "db" "primary" {
+  ami = "ami-456"
+}
+resource "aws_instance" "web" {
+  ami = "ami-123"
+}
+variable "region" {
+  default = "us-east-1"
+}
@@ -0,0 +1 @@
+Widget = [{ "name" = "foo", "tags" = { "env" = "dev" }, "size" = 1 }, { "name" = "baz" }]
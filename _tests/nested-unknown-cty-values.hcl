@@ -0,0 +1,5 @@
+objs = [{ "W" = "w" }]
+meta {
+  y = "y"
+}
+z = "z"
@@ -0,0 +1,2 @@
+Labeled "42" "paid" "10.0.0.1" "a" "b" "7" "free" "paid" {
+}
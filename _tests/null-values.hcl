@@ -0,0 +1,5 @@
+Default   = null
+Interface = null
+Map       = null
+Slice     = null
+NotNull   = "foo"
@@ -0,0 +1,7 @@
+big_int     = 123456789012345678901234567890
+big_float   = 1234567890.0987654321
+big_ints    = [-1]
+json_number = 1500
+cty         = 1234567890.0987654321
+float64     = -0.1
+float32     = 3.3
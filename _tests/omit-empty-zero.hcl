@@ -0,0 +1,8 @@
+ZeroSlice = []
+ZeroStruct {
+  Foo = []
+}
+ValidPort = 443
+AllPorts {
+}
+OtherPort = 8080
@@ -0,0 +1,10 @@
+ingress {
+  port = 80
+}
+egress {
+  port = 443
+}
+rule "foo" {
+}
+instance "bar" {
+}
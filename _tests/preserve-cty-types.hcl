@@ -0,0 +1,3 @@
+list = tolist(["a"])
+set  = toset(["$${a}", "$${b}"])
+map  = tomap({})
@@ -0,0 +1,7 @@
+name  = "aws"
+Inner = [{ "name" = "baz", "foo" = "bar" }]
+assume_role {
+  role_arn = "arn:aws:iam::123:role/foo"
+}
+region  = "us-east-1"
+retries = 3
@@ -0,0 +1,14 @@
+name = "web"
+
+instance "a" {
+  disk {
+    size = 10
+  }
+
+  disk {
+    size = 20
+  }
+}
+
+instance "b" {
+}
@@ -0,0 +1,11 @@
+instance "a" {
+  disk {
+    size = 10
+  }
+
+  disk {
+    size = 20
+  }
+}
+instance "b" {
+}
@@ -0,0 +1,12 @@
+subnet {
+  cidr = "10.0.0.0/24"
+  network {
+    name = "main"
+  }
+}
+subnet {
+  cidr = "10.0.1.0/24"
+  network {
+    name = "main"
+  }
+}
@@ -0,0 +1,10 @@
+name = "web"
+
+port {
+  number   = 80
+  protocol = "tcp"
+}
+
+port {
+  number = 53
+}
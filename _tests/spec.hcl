@@ -0,0 +1,25 @@
+name     = "web"
+replicas = 3
+tags     = { "team" = "platform" }
+env {
+  DEBUG = "$${not_a_template}"
+}
+image {
+  repository = "nginx"
+  tag        = "1.21"
+}
+mount "data" "/data" {
+}
+port {
+  number   = 80
+  protocol = "tcp"
+}
+port {
+  number = 53
+}
+volume "disk" "data" {
+  path = "/var/lib/data"
+}
+volume "tmpfs" "cache" {
+  path = "/var/cache"
+}
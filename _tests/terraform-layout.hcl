@@ -0,0 +1,20 @@
+resource "aws_instance" "web" {
+  count      = 2
+  provider   = aws.west
+  depends_on = [aws_vpc.main]
+
+  ami  = "ami-123"
+  tags = { "env" = "dev" }
+
+  ebs_block_device {
+    size = 10
+  }
+
+  ebs_block_device {
+    size = 20
+  }
+
+  lifecycle {
+    create_before_destroy = false
+  }
+}
@@ -0,0 +1,2 @@
+password = sensitive("secret")
+tags     = ["a"]
@@ -0,0 +1,57 @@
+package hclencoder
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Encodings of byte slices, selected with BytesTag.
+const (
+	BytesUTF8         = "utf8"
+	BytesBase64       = "base64"
+	BytesBase64Decode = "base64decode"
+	BytesHex          = "hex"
+)
+
+// validBytesEncoding reports whether a BytesTag names one of the supported encodings.
+func validBytesEncoding(encoding string) bool {
+	switch encoding {
+	case BytesUTF8, BytesBase64, BytesBase64Decode, BytesHex:
+		return true
+	}
+	return false
+}
+
+// tokenizeBytes converts a byte slice into a string according to the field's BytesTag, base64 by default like
+// encoding/json. Also like encoding/json, byte slices implementing encoding.TextMarshaler, such as net.IP, are encoded
+// as their text unless the field has a BytesTag.
+func (e *Encoder) tokenizeBytes(in reflect.Value, meta fieldMeta) (hclwrite.Tokens, error) {
+	if m, ok := implementation(in, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()); ok && meta.bytes == "" {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.pathString(len(e.path)), err)
+		}
+		return hclwrite.TokensForValue(cty.StringVal(string(text))), nil
+	}
+
+	b := in.Bytes()
+	switch meta.bytes {
+	case BytesUTF8:
+		if !utf8.Valid(b) {
+			return nil, fmt.Errorf("%s: bytes are not valid UTF-8", e.pathString(len(e.path)))
+		}
+		return hclwrite.TokensForValue(cty.StringVal(string(b))), nil
+	case BytesHex:
+		return hclwrite.TokensForValue(cty.StringVal(hex.EncodeToString(b))), nil
+	case BytesBase64Decode:
+		return tokenizeExpression(fmt.Sprintf("base64decode(%q)", base64.StdEncoding.EncodeToString(b)), meta.name)
+	default:
+		return hclwrite.TokensForValue(cty.StringVal(base64.StdEncoding.EncodeToString(b))), nil
+	}
+}
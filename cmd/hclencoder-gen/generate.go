@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/multy-dev/hclencoder"
+)
+
+// primitiveKinds maps the predeclared types encoded directly to the cty constructor used by the reflective encoder.
+var primitiveKinds = map[string]string{
+	"string": "string",
+	"bool":   "bool",
+	"int":    "int",
+	"int8":   "int",
+	"int16":  "int",
+	"int32":  "int",
+	"int64":  "int",
+	"rune":   "int",
+	"uint":   "uint",
+	"uint8":  "uint",
+	"uint16": "uint",
+	"uint32": "uint",
+	"uint64": "uint",
+	"byte":   "uint",
+}
+
+// field is a struct field as seen by the generator.
+type field struct {
+	goName      string
+	defaultName string
+	name        string
+	tag         string
+	kind        string // one of primitiveKinds' values, or "" if the field is encoded by the reflective encoder
+
+	key        bool
+	expression bool
+	omitEmpty  bool
+	remain     bool
+	skip       bool
+	order      int
+}
+
+// generate parses the non-test go files in dir and returns the formatted source of the EncodeHCL methods for types.
+func generate(dir string, types []string) ([]byte, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+	structs := map[string]*ast.StructType{}
+	pkgName := ""
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		pkgName = f.Name.Name
+		ast.Inspect(f, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					structs[spec.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+	if pkgName == "" {
+		return nil, fmt.Errorf("no go files found in %s", dir)
+	}
+
+	var buf bytes.Buffer
+	usesCty := false
+	for _, typeName := range types {
+		st, ok := structs[typeName]
+		if !ok {
+			return nil, fmt.Errorf("struct type %s not found in %s", typeName, dir)
+		}
+		fields, err := structFields(st)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", typeName, err)
+		}
+		for _, f := range fields {
+			usesCty = usesCty || f.usesCty()
+		}
+		writeMethod(&buf, typeName, fields)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by hclencoder-gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", pkgName)
+	fmt.Fprintf(&out, "import (\n")
+	fmt.Fprintf(&out, "\t%q\n", "github.com/hashicorp/hcl/v2/hclwrite")
+	fmt.Fprintf(&out, "\t%q\n", "github.com/multy-dev/hclencoder")
+	if usesCty {
+		fmt.Fprintf(&out, "\t%q\n", "github.com/zclconf/go-cty/cty")
+	}
+	fmt.Fprintf(&out, ")\n")
+	out.Write(buf.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+// structFields extracts the fields of a struct type along with the tags the generator understands. Fields with tags
+// it doesn't know how to encode directly are left to the reflective encoder.
+func structFields(st *ast.StructType) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		tag := ""
+		if f.Tag != nil {
+			var err error
+			if tag, err = strconv.Unquote(f.Tag.Value); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(f.Names) == 0 {
+			// embedded fields are named after their type, unless they're pointers
+			name := ""
+			switch t := f.Type.(type) {
+			case *ast.Ident:
+				name = t.Name
+			case *ast.SelectorExpr:
+				name = t.Sel.Name
+			}
+			fields = append(fields, newField(embeddedName(f.Type), name, tag, nil))
+			continue
+		}
+
+		for _, name := range f.Names {
+			fields = append(fields, newField(name.Name, name.Name, tag, f.Type))
+		}
+	}
+
+	// like the reflective encoder, fields are sorted by order and remain fields go last so they can be checked against
+	// every other field
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].remain != fields[j].remain {
+			return fields[j].remain
+		}
+		return fields[i].order < fields[j].order
+	})
+	return fields, nil
+}
+
+// embeddedName returns the name used to access an embedded field.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	}
+	return ""
+}
+
+func newField(goName, name, tag string, typ ast.Expr) field {
+	f := field{goName: goName, defaultName: name, name: name, tag: tag}
+
+	direct := true
+	tags := strings.Split(reflect.StructTag(tag).Get(hclencoder.HCLTagName), ",")
+	if tags[0] != "" {
+		f.name = tags[0]
+	}
+	for _, t := range tags[1:] {
+		switch t {
+		case hclencoder.KeyTag:
+			f.key = true
+		case hclencoder.Expression:
+			f.expression = true
+		case hclencoder.Blocks:
+		case hclencoder.RemainTag:
+			f.remain = true
+			direct = false
+		case hclencoder.UnusedKeysTag, hclencoder.DecodedFieldsTag:
+			f.skip = true
+		default:
+			direct = false
+		}
+	}
+	for _, t := range strings.Split(reflect.StructTag(tag).Get(hclencoder.HCLETagName), ",") {
+		switch t {
+		case "":
+		case hclencoder.OmitTag:
+			f.skip = true
+		case hclencoder.OmitEmptyTag:
+			f.omitEmpty = true
+		default:
+			order, err := strconv.Atoi(strings.TrimPrefix(t, hclencoder.OrderTag+"="))
+			switch {
+			case strings.HasPrefix(t, hclencoder.OrderTag+"=") && err == nil:
+				f.order = order
+			case strings.HasPrefix(t, hclencoder.GroupTag+"="):
+				// groups are laid out by hclencoder once the block is encoded
+			default:
+				direct = false
+			}
+		}
+	}
+
+	if ident, ok := typ.(*ast.Ident); ok && ident.Obj == nil && direct {
+		f.kind = primitiveKinds[ident.Name]
+	}
+	if f.key && f.kind != "string" {
+		f.kind = ""
+	}
+	return f
+}
+
+// usesCty reports whether the generated code for the field converts it into a cty.Value.
+func (f field) usesCty() bool {
+	return f.kind != "" && !f.skip && !f.key && !(f.kind == "string" && f.expression)
+}
+
+func writeMethod(buf *bytes.Buffer, typeName string, fields []field) {
+	fmt.Fprintf(buf, "\n// EncodeHCL implements hclencoder.Marshaler.\n")
+	fmt.Fprintf(buf, "func (v %s) EncodeHCL(enc *hclencoder.Encoder, blockType string) (*hclwrite.Block, error) {\n", typeName)
+	fmt.Fprintf(buf, "block := hclwrite.NewBlock(blockType, nil)\n")
+
+	for _, f := range fields {
+		if f.skip {
+			continue
+		}
+		if f.kind == "" {
+			fmt.Fprintf(buf, "if err := enc.AppendField(block, %q, %s, &v.%s); err != nil {\n", f.defaultName, quote(f.tag), f.goName)
+			fmt.Fprintf(buf, "return nil, err\n}\n")
+			continue
+		}
+
+		value := "v." + f.goName
+		if f.omitEmpty {
+			switch f.kind {
+			case "string":
+				fmt.Fprintf(buf, "if %s != \"\" {\n", value)
+			case "bool":
+				fmt.Fprintf(buf, "if %s {\n", value)
+			default:
+				fmt.Fprintf(buf, "if %s != 0 {\n", value)
+			}
+		}
+
+		switch {
+		case f.key:
+			fmt.Fprintf(buf, "block.SetLabels(append(block.Labels(), %s))\n", value)
+		case f.kind == "string" && f.expression:
+			fmt.Fprintf(buf, "if tokens, err := hclencoder.ExpressionTokens(%s); err != nil {\n", value)
+			fmt.Fprintf(buf, "return nil, err\n")
+			fmt.Fprintf(buf, "} else {\nblock.Body().SetAttributeRaw(%q, tokens)\n}\n", f.name)
+		default:
+			fmt.Fprintf(buf, "block.Body().SetAttributeRaw(%q, hclwrite.TokensForValue(%s))\n", f.name, ctyValue(f.kind, value))
+		}
+
+		if f.omitEmpty {
+			fmt.Fprintf(buf, "}\n")
+		}
+	}
+
+	fmt.Fprintf(buf, "return block, nil\n}\n")
+}
+
+// quote returns a go string literal for s, preferring raw strings as used for struct tags.
+func quote(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+// ctyValue returns the expression converting value into a cty.Value the same way the reflective encoder does.
+func ctyValue(kind, value string) string {
+	switch kind {
+	case "string":
+		return fmt.Sprintf("cty.StringVal(%s)", value)
+	case "bool":
+		return fmt.Sprintf("cty.BoolVal(%s)", value)
+	case "int":
+		return fmt.Sprintf("cty.NumberIntVal(int64(%s))", value)
+	case "uint":
+		return fmt.Sprintf("cty.NumberUIntVal(uint64(%s))", value)
+	}
+	panic("unknown kind " + kind)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateIsUpToDate(t *testing.T) {
+	expected, err := ioutil.ReadFile("../../internal/gentest/config_hcl.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := generate("../../internal/gentest", []string{"Config", "Farm", "Farmer", "Animal"})
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func TestGenerateUnknownType(t *testing.T) {
+	_, err := generate("../../internal/gentest", []string{"Missing"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// hclencoder-gen generates reflection-free hclencoder.Marshaler implementations for tagged struct types.
+//
+// It is meant to be used with go generate:
+//
+//	//go:generate go run github.com/multy-dev/hclencoder/cmd/hclencoder-gen -type=Config,Farmer
+//
+// For each type, an EncodeHCL method is written to <type>_hcl.go (or the file given by -output). Primitive fields are
+// encoded directly into hclwrite tokens; every other field is handed back to the reflective encoder, so the output of
+// hclencoder.Encode is the same with or without the generated code. Types that embed a type with an EncodeHCL method
+// are still encoded reflectively, since hclencoder can't tell their own method apart from the promoted one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("hclencoder-gen: ")
+
+	typeNames := flag.String("type", "", "comma-separated list of struct type names; required")
+	output := flag.String("output", "", "output file name; default <dir>/<type>_hcl.go")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: hclencoder-gen -type T[,T...] [-output file] [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	types := strings.Split(*typeNames, ",")
+	src, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, strings.ToLower(types[0])+"_hcl.go")
+	}
+	if err := ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
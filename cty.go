@@ -0,0 +1,141 @@
+package hclencoder
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"reflect"
+)
+
+// encodeCtyValue converts a cty.Value into a block for a Block tag, into repeated blocks for a Blocks tag, or into an
+// expression otherwise.
+func (e *Encoder) encodeCtyValue(in reflect.Value, meta fieldMeta) (*node, error) {
+	val := in.Interface().(cty.Value)
+	switch {
+	case meta.block:
+		block, err := e.ctyBlock(val, meta, nil)
+		if err != nil || block == nil {
+			return nil, err
+		}
+		return &node{Block: block}, nil
+	case meta.repeatBlock:
+		blocks, err := e.appendCtyBlocks([]*hclwrite.Block{}, val, meta, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &node{BlockList: blocks}, nil
+	}
+	return e.encodePrimitive(in, meta)
+}
+
+// ctyBlock converts an object or a map into a block with an attribute for each of its elements. Nested objects are
+// written as attribute values, since nothing tells them apart from nested blocks. The marks of an object are kept by
+// each of its attributes, while marked maps are an error since their keys would be written unmarked. Null values and
+// unknown values omitted with OmitUnknowns return a nil block.
+func (e *Encoder) ctyBlock(val cty.Value, meta fieldMeta, labels []string) (*hclwrite.Block, error) {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return nil, err
+	}
+	ty := val.Type()
+	if !ty.IsObjectType() && !ty.IsMapType() {
+		return nil, fmt.Errorf("%s: blocks must be objects or maps, %s given", e.pathString(len(e.path)), ty.FriendlyName())
+	}
+	if ty.IsMapType() && len(marks) > 0 {
+		return nil, fmt.Errorf("%s: the keys of marked maps can't be written as attribute names", e.pathString(len(e.path)))
+	}
+
+	opts := e.ctyValueOptions(meta)
+	block := hclwrite.NewBlock(meta.name, labels)
+	for it := val.ElementIterator(); it.Next(); {
+		key, elem := it.Element()
+		attr := key.AsString()
+		if !hclsyntax.ValidIdentifier(attr) {
+			return nil, fmt.Errorf("%s: %q is not a valid attribute name", e.pathString(len(e.path)), attr)
+		}
+
+		str, err := ValueToString(elem.WithMarks(marks), opts...)
+		if err == ErrUnknownOmitted {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.pathString(len(e.path)), err)
+		}
+		tokens, err := tokenizeExpression(str, attr)
+		if err != nil {
+			return nil, err
+		}
+		block.Body().SetAttributeRaw(attr, tokens)
+	}
+
+	e.layout(block, nil)
+	return block, nil
+}
+
+// appendCtyBlocks converts a list, set or tuple of objects into repeated blocks. Like Go maps with a Blocks tag, the
+// keys of maps become the labels of their blocks. The marks of a collection are kept by its elements, except for
+// marked maps which are an error since their keys would be written unmarked.
+func (e *Encoder) appendCtyBlocks(blocks []*hclwrite.Block, val cty.Value, meta fieldMeta, labels []string) ([]*hclwrite.Block, error) {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return blocks, err
+	}
+
+	ty := val.Type()
+	if !ty.IsListType() && !ty.IsSetType() && !ty.IsTupleType() && !ty.IsMapType() {
+		block, err := e.ctyBlock(val.WithMarks(marks), meta, labels)
+		if err != nil || block == nil {
+			return blocks, err
+		}
+		return append(blocks, block), nil
+	}
+
+	if ty.IsMapType() && len(marks) > 0 {
+		return nil, fmt.Errorf("%s: the keys of marked maps can't be written as labels", e.pathString(len(e.path)))
+	}
+
+	i := 0
+	for it := val.ElementIterator(); it.Next(); i++ {
+		key, elem := it.Element()
+		elemLabels := labels
+		segment := indexSegment(i)
+		if ty.IsMapType() {
+			elemLabels = append(labels[:len(labels):len(labels)], key.AsString())
+			segment = keySegment(key.AsString())
+		}
+
+		if err := e.push(segment); err != nil {
+			return nil, err
+		}
+		var err error
+		blocks, err = e.appendCtyBlocks(blocks, elem.WithMarks(marks), meta, elemLabels)
+		e.pop()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// ctyValueOptions returns the ValueOptions rendering the cty.Values of a field, escaping their templates if it has the
+// literal tag.
+func (e *Encoder) ctyValueOptions(meta fieldMeta) []ValueOption {
+	opts := e.valueOptions[:len(e.valueOptions):len(e.valueOptions)]
+	if meta.literal {
+		opts = append(opts, LiteralStrings())
+	}
+	return opts
+}
+
+// ctyBlockKnown reports whether a value can be written as blocks: null values can't, and neither can unknown values,
+// which are an error unless OmitUnknowns is given.
+func (e *Encoder) ctyBlockKnown(val cty.Value) (bool, error) {
+	if !val.IsKnown() {
+		if newValueFormat(e.valueOptions...).omitUnknowns {
+			return false, nil
+		}
+		return false, fmt.Errorf("%s: can't encode unknown values as blocks", e.pathString(len(e.path)))
+	}
+	return !val.IsNull(), nil
+}
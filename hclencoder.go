@@ -7,12 +7,53 @@ import (
 )
 
 // Encode converts any supported type into the corresponding HCL format
-func Encode(in interface{}) ([]byte, error) {
-	node, err := encode(reflect.ValueOf(in))
+func Encode(in interface{}, opts ...Option) ([]byte, error) {
+	return NewEncoder(opts...).Encode(in)
+}
+
+// Encoder converts values into HCL according to its options. It's also handed to Marshaler implementations so they can
+// fall back to the reflective encoder for single fields.
+type Encoder struct {
+	attributesFirst      bool
+	customLayout         Layout
+	separateBlocks       bool
+	separateNestedBlocks bool
+	maxDepth             int
+	fixedFloats          bool
+	floatPrecision       int
+	valueOptions         []ValueOption
+
+	// path and visiting track the value being encoded, to name it in errors and to detect cycles.
+	path     []string
+	visiting map[visit]int
+	// structType is the struct whose fields are being encoded, to check the keys of remain fields against them.
+	structType reflect.Type
+}
+
+// NewEncoder returns an Encoder configured with opts.
+func NewEncoder(opts ...Option) *Encoder {
+	e := &Encoder{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Encode converts any supported type into the corresponding HCL format
+func (e *Encoder) Encode(in interface{}) ([]byte, error) {
+	// every call gets its own path, so an Encoder can be shared between goroutines
+	enc := *e
+	enc.path, enc.visiting, enc.structType = nil, nil, nil
+
+	node, err := enc.encode(reflect.ValueOf(in))
 	if err != nil {
 		return nil, err
 	}
+	return enc.writeFile(node)
+}
 
+// writeFile formats the root node of a file, which must be a block or a block list.
+func (e *Encoder) writeFile(node *node) ([]byte, error) {
 	f := hclwrite.NewEmptyFile()
 	if node.isBlock() {
 		addRootBlock(node.Block, f)
@@ -23,14 +64,17 @@ func Encode(in interface{}) ([]byte, error) {
 	} else {
 		return nil, errors.New("invalid root type - needs to be a block or block list")
 	}
+	if e.separateBlocks {
+		separateBlocks(f.Body())
+	}
 
 	return hclwrite.Format(f.Bytes()), nil
 }
 
 func addRootBlock(block *hclwrite.Block, f *hclwrite.File) {
-	// root blocks without types are squashed by default
+	// root blocks without types are squashed by default, keeping the blank lines of their layout
 	if block.Type() == "" {
-		squashBlock(block, f.Body())
+		appendBodyItems(f.Body(), bodyItems(block.Body()))
 	} else {
 		f.Body().AppendBlock(block)
 	}
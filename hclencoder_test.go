@@ -1,19 +1,140 @@
 package hclencoder
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/zclconf/go-cty/cty"
 	"io/ioutil"
+	"math"
+	"math/big"
+	"net"
 	"testing"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// port is considered zero when it isn't a valid port number
+type port int
+
+func (p port) IsZero() bool {
+	return p <= 0
+}
+
+// allPorts matches every port when it has no ranges, so it's never zero
+type allPorts struct {
+	Ranges []string `hcl:"ranges" hcle:"omitempty"`
+}
+
+func (allPorts) IsZero() bool {
+	return false
+}
+
+type Common struct {
+	Tags map[string]string `hcl:"tags" hcle:"omitempty"`
+}
+
+type widget struct {
+	Label  string `hcl:",key"`
+	Name   string `hcl:"name"`
+	Common `hcl:",squash"`
+	Secret string   `hcle:"omit"`
+	Unused []string `hcl:",unusedKeys"`
+	Size   int      `hcl:"size" hcle:"omitempty"`
+}
+
+type instance struct {
+	Name string `hcl:",key" hcle:"omitempty"`
+	Ami  string `hcl:"ami" hcle:"omitempty"`
+}
+
+type ingress struct {
+	Port int `hcl:"port"`
+}
+
+func (ingress) HCLBlockType() string {
+	return "ingress"
+}
+
+type egress struct {
+	Port int `hcl:"port"`
+}
+
+func (*egress) HCLBlockType() string {
+	return "egress"
+}
+
+type resource struct {
+	Type string `hcle:"omit"`
+	Name string `hcl:",key"`
+	Ami  string `hcl:"ami"`
+}
+
+func (r resource) HCLBlockType() string {
+	return "resource"
+}
+
+func (r resource) HCLLabels() []string {
+	return []string{r.Type, r.Name}
+}
+
+type tier int
+
+func (t tier) String() string {
+	return [...]string{"free", "paid"}[t]
+}
+
+type labeled struct {
+	ID     int      `hcl:",key"`
+	Tier   tier     `hcl:",key"`
+	IP     net.IP   `hcl:",key"`
+	Path   []string `hcl:",key"`
+	Zone   *uint    `hcl:",key"`
+	Tags   [2]tier  `hcl:",key"`
+	Unused []string `hcl:",key" hcle:"omitempty"`
+}
+
+type network struct {
+	Name    string    `hcl:"name"`
+	Subnets []*subnet `hcl:"subnet,blocks"`
+}
+
+type subnet struct {
+	CIDR    string   `hcl:"cidr"`
+	Network *network `hcl:"network"`
+}
+
+// networks returns a network whose subnet refers back to it if cyclic, or two subnets sharing a network otherwise.
+func networks(cyclic bool) interface{} {
+	shared := &network{Name: "main"}
+	if cyclic {
+		shared.Subnets = []*subnet{{CIDR: "10.0.0.0/24", Network: shared}}
+		return struct {
+			Network *network `hcl:"network"`
+		}{shared}
+	}
+	return struct {
+		Subnets []*subnet `hcl:"subnet,blocks"`
+	}{[]*subnet{{CIDR: "10.0.0.0/24", Network: shared}, {CIDR: "10.0.1.0/24", Network: shared}}}
+}
+
+type remainProvider struct {
+	Extra map[string]string `hcl:",remain"`
+}
+
+type squashedRemain struct {
+	Name     string            `hcl:"name"`
+	Provider remainProvider    `hcl:",squash"`
+	Extra    map[string]string `hcl:",remain"`
+}
+
 type encoderTest2 struct {
-	ID     string
-	Input  interface{}
-	Output string
-	Error  bool
+	ID           string
+	Input        interface{}
+	Options      []Option
+	Output       string
+	Error        bool
+	ErrorMessage string
 }
 
 func TestEncoder(t *testing.T) {
@@ -208,6 +329,482 @@ func TestEncoder(t *testing.T) {
 			},
 			Output: "nested-struct-slice-no-key",
 		},
+		{
+			ID: "nested struct slice tags",
+			Input: struct {
+				Widget []widget
+			}{
+				Widget: []widget{
+					{
+						Name:   "foo",
+						Common: Common{Tags: map[string]string{"env": "dev"}},
+						Size:   1,
+						Secret: "hunter2",
+						Unused: []string{"bar"},
+					},
+					{
+						Name:  "baz",
+						Label: "buzz",
+					},
+				},
+			},
+			Output: "nested-struct-slice-tags",
+		},
+		{
+			ID: "map blocks",
+			Input: struct {
+				Resources map[string]map[string]instance `hcl:"resource,blocks"`
+				Variables map[string]*struct {
+					Default string `hcl:"default"`
+				} `hcl:"variable,blocks"`
+			}{
+				Resources: map[string]map[string]instance{
+					"aws_instance": {
+						"web": {Ami: "ami-123"},
+						"db":  {Ami: "ami-456", Name: "primary"},
+					},
+					"aws_ebs_volume": {
+						"data": {},
+					},
+				},
+				Variables: map[string]*struct {
+					Default string `hcl:"default"`
+				}{
+					"region": {Default: "us-east-1"},
+					"nil":    nil,
+				},
+			},
+			Output: "map-blocks",
+		},
+		{
+			ID: "map blocks of primitives",
+			Input: struct {
+				Resources map[string]string `hcl:"resource,blocks"`
+			}{
+				Resources: map[string]string{"foo": "bar"},
+			},
+			Error: true,
+		},
+		{
+			ID: "map block",
+			Input: struct {
+				Meta map[string]interface{} `hcl:"meta,block"`
+				Env  map[string]string      `hcl:"env,block"`
+			}{
+				Meta: map[string]interface{}{
+					"owner":    "ops",
+					"replicas": 3,
+					"zones":    []string{"a", "b"},
+				},
+				Env: map[string]string{},
+			},
+			Output: "map-block",
+		},
+		{
+			ID: "map block invalid key",
+			Input: struct {
+				Meta map[string]string `hcl:"meta,block"`
+			}{
+				Meta: map[string]string{"not valid": "foo"},
+			},
+			Error: true,
+		},
+		{
+			ID: "remain",
+			Input: struct {
+				Extra map[string]interface{} `hcl:",remain"`
+				Name  string                 `hcl:"name"`
+				Inner []struct {
+					Extra map[string]string `hcl:",remain"`
+					Name  string            `hcl:"name"`
+				}
+			}{
+				Extra: map[string]interface{}{
+					"region":  "us-east-1",
+					"retries": 3,
+					"nil":     nil,
+					"assume_role": struct {
+						RoleArn string `hcl:"role_arn"`
+					}{"arn:aws:iam::123:role/foo"},
+				},
+				Name: "aws",
+				Inner: []struct {
+					Extra map[string]string `hcl:",remain"`
+					Name  string            `hcl:"name"`
+				}{
+					{Extra: map[string]string{"foo": "bar"}, Name: "baz"},
+				},
+			},
+			Output: "remain",
+		},
+		{
+			ID: "remain collision",
+			Input: struct {
+				Name  string            `hcl:"name"`
+				Extra map[string]string `hcl:",remain"`
+			}{
+				Name:  "aws",
+				Extra: map[string]string{"name": "gcp"},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision with omitted field",
+			Input: struct {
+				Name  string            `hcl:"name" hcle:"omitempty"`
+				Extra map[string]string `hcl:",remain"`
+			}{
+				Extra: map[string]string{"name": "gcp"},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision with squashed field",
+			Input: struct {
+				Provider struct {
+					Region *string `hcl:"region"`
+				} `hcl:",squash"`
+				Extra map[string]string `hcl:",remain"`
+			}{
+				Extra: map[string]string{"region": "us-east-1"},
+			},
+			ErrorMessage: `remain key "region" collides with field Region`,
+		},
+		{
+			ID: "remain collision in squashed struct",
+			Input: struct {
+				Name     string `hcl:"name"`
+				Provider struct {
+					Extra map[string]string `hcl:",remain"`
+				} `hcl:",squash"`
+			}{
+				Name: "aws",
+				Provider: struct {
+					Extra map[string]string `hcl:",remain"`
+				}{Extra: map[string]string{"name": "gcp"}},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision in squashed struct before field",
+			Input: struct {
+				Provider struct {
+					Extra map[string]string `hcl:",remain"`
+				} `hcl:",squash"`
+				Name string `hcl:"name"`
+			}{
+				Provider: struct {
+					Extra map[string]string `hcl:",remain"`
+				}{Extra: map[string]string{"name": "gcp"}},
+				Name: "aws",
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision with squashed remain",
+			Input: struct {
+				Provider struct {
+					Extra map[string]string `hcl:",remain"`
+				} `hcl:",squash"`
+				Extra map[string]string `hcl:",remain"`
+			}{
+				Provider: struct {
+					Extra map[string]string `hcl:",remain"`
+				}{Extra: map[string]string{"region": "us-east-1"}},
+				Extra: map[string]string{"region": "us-west-2"},
+			},
+			ErrorMessage: `remain key "region" collides with an attribute or block`,
+		},
+		{
+			ID: "remain collision in object",
+			Input: struct {
+				Inner []struct {
+					Name  string            `hcl:"name"`
+					Extra map[string]string `hcl:",remain"`
+				}
+			}{
+				Inner: []struct {
+					Name  string            `hcl:"name"`
+					Extra map[string]string `hcl:",remain"`
+				}{
+					{Name: "aws", Extra: map[string]string{"name": "gcp"}},
+				},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision in squashed struct in object",
+			Input: struct {
+				Inner []squashedRemain
+			}{
+				Inner: []squashedRemain{{
+					Name:     "aws",
+					Provider: remainProvider{Extra: map[string]string{"name": "gcp"}},
+				}},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "remain collision with squashed remain in object",
+			Input: struct {
+				Inner []squashedRemain
+			}{
+				Inner: []squashedRemain{{
+					Provider: remainProvider{Extra: map[string]string{"region": "us-east-1"}},
+					Extra:    map[string]string{"region": "us-west-2"},
+				}},
+			},
+			ErrorMessage: `remain key "region" collides with an attribute or block`,
+		},
+		{
+			ID: "remain collision with omitted field in object",
+			Input: struct {
+				Inner []struct {
+					Name  string            `hcl:"name" hcle:"omitempty"`
+					Extra map[string]string `hcl:",remain"`
+				}
+			}{
+				Inner: []struct {
+					Name  string            `hcl:"name" hcle:"omitempty"`
+					Extra map[string]string `hcl:",remain"`
+				}{
+					{Extra: map[string]string{"name": "gcp"}},
+				},
+			},
+			ErrorMessage: `remain key "name" collides with field Name`,
+		},
+		{
+			ID: "polymorphic blocks",
+			Input: struct {
+				Rules    []interface{} `hcl:"rule,blocks"`
+				Pointers []*instance   `hcl:"instance,blocks"`
+			}{
+				Rules: []interface{}{
+					ingress{80},
+					&egress{443},
+					nil,
+					(*ingress)(nil),
+					instance{Name: "foo"},
+				},
+				Pointers: []*instance{nil, {Name: "bar"}},
+			},
+			Output: "polymorphic-blocks",
+		},
+		{
+			ID: "polymorphic blocks of primitives",
+			Input: struct {
+				Rules []interface{} `hcl:"rule,blocks"`
+			}{
+				Rules: []interface{}{"foo"},
+			},
+			Error: true,
+		},
+		{
+			ID: "block type and labels interfaces",
+			Input: struct {
+				Instance resource
+				Volumes  []resource `hcl:",blocks"`
+			}{
+				Instance: resource{Type: "aws_instance", Name: "web", Ami: "ami-123"},
+				Volumes: []resource{
+					{Type: "aws_ebs_volume", Name: "data"},
+				},
+			},
+			Output: "block-interfaces",
+		},
+		{
+			ID:     "root block type and labels interfaces",
+			Input:  resource{Type: "aws_instance", Name: "web", Ami: "ami-123"},
+			Output: "root-block-interfaces",
+		},
+		{
+			ID: "non-string labels",
+			Input: struct {
+				Labeled labeled
+			}{
+				Labeled: labeled{
+					ID:   42,
+					Tier: 1,
+					IP:   net.IPv4(10, 0, 0, 1),
+					Path: []string{"a", "b"},
+					Zone: &[]uint{7}[0],
+					Tags: [2]tier{0, 1},
+				},
+			},
+			Output: "non-string-labels",
+		},
+		{
+			ID: "invalid label",
+			Input: struct {
+				Foo struct {
+					Key float64 `hcl:",key"`
+				}
+			}{},
+			Error: true,
+		},
+		{
+			ID: "field order",
+			Input: struct {
+				Foo struct {
+					Bar string `hcl:"bar"`
+				}
+				Common `hcl:",squash" hcle:"order=1"`
+				Name   string `hcl:"name"`
+				Count  int    `hcl:"count" hcle:"order=-1"`
+			}{
+				Common: Common{Tags: map[string]string{"env": "dev"}},
+				Name:   "web",
+				Count:  2,
+			},
+			Output: "field-order",
+		},
+		{
+			ID: "attributes first",
+			Input: struct {
+				Foo struct {
+					Bar   string `hcl:"bar"`
+					Inner struct{}
+					Baz   string `hcl:"baz"`
+				}
+				Common `hcl:",squash"`
+				Name   string `hcl:"name"`
+			}{
+				Common: Common{Tags: map[string]string{"env": "dev"}},
+				Name:   "web",
+			},
+			Options: []Option{AttributesFirst()},
+			Output:  "attributes-first",
+		},
+		{
+			ID: "terraform layout",
+			Input: struct {
+				Resources []struct {
+					Type      string `hcl:",key"`
+					Name      string `hcl:",key"`
+					AMI       string `hcl:"ami"`
+					Lifecycle struct {
+						CreateBeforeDestroy bool `hcl:"create_before_destroy"`
+					} `hcl:"lifecycle"`
+					Tags      map[string]string `hcl:"tags"`
+					DependsOn []string          `hcl:"depends_on,expr"`
+					Count     int               `hcl:"count"`
+					Disk      []struct {
+						Size int `hcl:"size"`
+					} `hcl:"ebs_block_device,blocks"`
+					Provider string `hcl:"provider,expr"`
+				} `hcl:"resource,blocks"`
+			}{
+				Resources: []struct {
+					Type      string `hcl:",key"`
+					Name      string `hcl:",key"`
+					AMI       string `hcl:"ami"`
+					Lifecycle struct {
+						CreateBeforeDestroy bool `hcl:"create_before_destroy"`
+					} `hcl:"lifecycle"`
+					Tags      map[string]string `hcl:"tags"`
+					DependsOn []string          `hcl:"depends_on,expr"`
+					Count     int               `hcl:"count"`
+					Disk      []struct {
+						Size int `hcl:"size"`
+					} `hcl:"ebs_block_device,blocks"`
+					Provider string `hcl:"provider,expr"`
+				}{{
+					Type:      "aws_instance",
+					Name:      "web",
+					AMI:       "ami-123",
+					Tags:      map[string]string{"env": "dev"},
+					DependsOn: []string{"aws_vpc.main"},
+					Count:     2,
+					Disk: []struct {
+						Size int `hcl:"size"`
+					}{{Size: 10}, {Size: 20}},
+					Provider: "aws.west",
+				}},
+			},
+			Options: []Option{WithLayout(TerraformLayout)},
+			Output:  "terraform-layout",
+		},
+		{
+			ID: "attribute groups",
+			Input: struct {
+				Name   string `hcl:"name"`
+				Common `hcl:",squash"`
+				VPC    string `hcl:"vpc" hcle:"group=network"`
+				Subnet string `hcl:"subnet" hcle:"group=network"`
+				Foo    struct {
+					Bar string `hcl:"bar"`
+				}
+				Port  int    `hcl:"port" hcle:"group=network"`
+				Owner string `hcl:"owner" hcle:"group=meta"`
+			}{
+				Name:   "web",
+				Common: Common{Tags: map[string]string{"env": "dev"}},
+				VPC:    "main",
+				Subnet: "private",
+				Port:   80,
+				Owner:  "ops",
+			},
+			Output: "attribute-groups",
+		},
+		{
+			ID: "separate blocks",
+			Input: struct {
+				Name      string `hcl:"name"`
+				Instances []struct {
+					Name string `hcl:",key"`
+					Disk []struct {
+						Size int `hcl:"size"`
+					} `hcl:"disk,blocks"`
+				} `hcl:"instance,blocks"`
+			}{
+				Name: "web",
+				Instances: []struct {
+					Name string `hcl:",key"`
+					Disk []struct {
+						Size int `hcl:"size"`
+					} `hcl:"disk,blocks"`
+				}{
+					{Name: "a", Disk: []struct {
+						Size int `hcl:"size"`
+					}{{Size: 10}, {Size: 20}}},
+					{Name: "b"},
+				},
+			},
+			Options: []Option{SeparateBlocks(), SeparateNestedBlocks()},
+			Output:  "separate-blocks",
+		},
+		{
+			ID: "separate nested blocks",
+			Input: struct {
+				Instances []struct {
+					Name string `hcl:",key"`
+					Disk []struct {
+						Size int `hcl:"size"`
+					} `hcl:"disk,blocks"`
+				} `hcl:"instance,blocks"`
+			}{
+				Instances: []struct {
+					Name string `hcl:",key"`
+					Disk []struct {
+						Size int `hcl:"size"`
+					} `hcl:"disk,blocks"`
+				}{
+					{Name: "a", Disk: []struct {
+						Size int `hcl:"size"`
+					}{{Size: 10}, {Size: 20}}},
+					{Name: "b"},
+				},
+			},
+			Options: []Option{SeparateNestedBlocks()},
+			Output:  "separate-nested-blocks",
+		},
+		{
+			ID: "invalid order",
+			Input: struct {
+				Name string `hcle:"order=first"`
+			}{},
+			Error: true,
+		},
 		{
 			ID: "maps",
 			Input: struct {
@@ -225,6 +822,83 @@ func TestEncoder(t *testing.T) {
 			},
 			Output: "maps",
 		},
+		{
+			ID: "null values",
+			Input: struct {
+				Default   *string           `hcle:"null"`
+				Interface interface{}       `hcle:"null"`
+				Map       map[string]string `hcle:"null"`
+				Slice     []string          `hcle:"null"`
+				Omitted   *string           `hcle:"null,omitempty"`
+				NotNull   *string           `hcle:"null"`
+				Skipped   *string
+			}{
+				NotNull: &[]string{"foo"}[0],
+			},
+			Output: "null-values",
+		},
+		{
+			ID: "null block",
+			Input: struct {
+				Block *struct{ Foo string } `hcl:"block" hcle:"null"`
+			}{},
+			ErrorMessage: "field block: the null tag only applies to attributes, not to blocks",
+		},
+		{
+			ID: "null block list",
+			Input: struct {
+				Blocks []struct{ Foo string } `hcl:"block,blocks" hcle:"null"`
+			}{},
+			ErrorMessage: "field block: the null tag only applies to attributes, not to blocks",
+		},
+		{
+			ID: "omit empty and zero",
+			Input: struct {
+				EmptySlice    []string               `hcle:"omitempty"`
+				EmptyMap      map[string]string      `hcle:"omitempty"`
+				ZeroSlice     []string               `hcle:"omitzero"`
+				EmptyStruct   struct{ Foo []string } `hcle:"omitempty"`
+				ZeroStruct    struct{ Foo []string } `hcle:"omitzero"`
+				InvalidPort   port                   `hcle:"omitzero"`
+				ValidPort     port                   `hcle:"omitzero"`
+				AllPorts      allPorts               `hcle:"omitempty"`
+				DefaultPort   int                    `hcle:"default=80"`
+				OtherPort     int                    `hcle:"default=80"`
+				DefaultString *string                `hcle:"default=tcp"`
+				DefaultBool   bool                   `hcle:"default=true"`
+				DefaultFloat  float32                `hcle:"default=0.1"`
+			}{
+				EmptySlice:    []string{},
+				EmptyMap:      map[string]string{},
+				ZeroSlice:     []string{},
+				EmptyStruct:   struct{ Foo []string }{[]string{}},
+				ZeroStruct:    struct{ Foo []string }{[]string{}},
+				InvalidPort:   -1,
+				ValidPort:     443,
+				DefaultPort:   80,
+				OtherPort:     8080,
+				DefaultString: &[]string{"tcp"}[0],
+				DefaultBool:   true,
+				DefaultFloat:  0.1,
+			},
+			Output: "omit-empty-zero",
+		},
+		{
+			ID: "default on non-primitive",
+			Input: struct {
+				Slice []string `hcle:"default=foo"`
+			}{
+				[]string{"foo"},
+			},
+			Error: true,
+		},
+		{
+			ID: "invalid default",
+			Input: struct {
+				Int int `hcle:"default=foo"`
+			}{},
+			Error: true,
+		},
 		{
 			ID: "nested slices",
 			Input: struct {
@@ -249,13 +923,375 @@ func TestEncoder(t *testing.T) {
 		},
 	}
 
+	type disk struct {
+		Size int `hcl:"size"`
+	}
+	tests = append(tests,
+		encoderTest2{
+			ID: "kinds",
+			Input: struct {
+				Array       [2]string     `hcl:"array"`
+				Float32     float32       `hcl:"float32"`
+				Float32s    []float32     `hcl:"float32s"`
+				Interface   interface{}   `hcl:"interface"`
+				Interfaces  []interface{} `hcl:"interfaces"`
+				ArrayBlocks [2]disk       `hcl:"array_disk,blocks"`
+				Nested      [][]disk      `hcl:"nested_disk,blocks"`
+				Mixed       []interface{} `hcl:"mixed_disk,blocks"`
+			}{
+				Array:       [2]string{"a", "b"},
+				Float32:     0.1,
+				Float32s:    []float32{1.5, 3.3},
+				Interface:   []interface{}{[]int{1, 2}, [1]string{"a"}},
+				Interfaces:  []interface{}{[]interface{}{true}, nil},
+				ArrayBlocks: [2]disk{{Size: 1}, {Size: 2}},
+				Nested:      [][]disk{{{Size: 3}}, nil, {{Size: 4}, {Size: 5}}},
+				Mixed:       []interface{}{disk{Size: 6}, []*disk{{Size: 7}, nil}, [1]interface{}{disk{Size: 8}}},
+			},
+			Output: "kinds",
+		},
+		encoderTest2{
+			ID: "chan",
+			Input: struct {
+				Chan chan int
+			}{make(chan int)},
+			Error: true,
+		},
+		encoderTest2{
+			ID: "func",
+			Input: struct {
+				Func func()
+			}{func() {}},
+			Error: true,
+		},
+		encoderTest2{
+			ID: "complex",
+			Input: struct {
+				Complex []complex128
+			}{[]complex128{1i}},
+			Error: true,
+		},
+		encoderTest2{
+			ID: "unsafe pointer",
+			Input: struct {
+				Pointer unsafe.Pointer
+			}{unsafe.Pointer(&[]int{1}[0])},
+			Error: true,
+		},
+	)
+
+	bigInt, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	bigFloat, _, _ := big.ParseFloat("1234567890.0987654321", 10, 256, big.ToNearestEven)
+	type numbers struct {
+		BigInt     *big.Int    `hcl:"big_int"`
+		BigFloat   *big.Float  `hcl:"big_float"`
+		BigInts    []big.Int   `hcl:"big_ints"`
+		JSONNumber json.Number `hcl:"json_number"`
+		Cty        cty.Value   `hcl:"cty"`
+		Float64    float64     `hcl:"float64"`
+		Float32    float32     `hcl:"float32"`
+	}
+	tests = append(tests,
+		encoderTest2{
+			ID: "numbers",
+			Input: numbers{
+				BigInt:     bigInt,
+				BigFloat:   bigFloat,
+				BigInts:    []big.Int{*big.NewInt(-1)},
+				JSONNumber: "1.5e3",
+				Cty:        cty.NumberVal(bigFloat),
+				Float64:    -0.1,
+				Float32:    3.3,
+			},
+			Output: "numbers",
+		},
+		encoderTest2{
+			ID: "float precision",
+			Input: numbers{
+				BigFloat: bigFloat,
+				Float64:  -0.1,
+				Float32:  3.3,
+			},
+			Options: []Option{FloatPrecision(2)},
+			Output:  "float-precision",
+		},
+		encoderTest2{
+			ID:    "NaN",
+			Input: numbers{Float64: math.NaN()},
+			Error: true,
+		},
+		encoderTest2{
+			ID:    "infinite float",
+			Input: numbers{Float32: float32(math.Inf(1))},
+			Error: true,
+		},
+		encoderTest2{
+			ID:    "infinite big float",
+			Input: numbers{BigFloat: new(big.Float).SetInf(true)},
+			Error: true,
+		},
+		encoderTest2{
+			ID:    "infinite cty number",
+			Input: numbers{Cty: cty.NegativeInfinity},
+			Error: true,
+		},
+		encoderTest2{
+			ID:    "invalid json number",
+			Input: numbers{JSONNumber: "one"},
+			Error: true,
+		},
+	)
+
+	hello := []byte("hello")
+	tests = append(tests,
+		encoderTest2{
+			ID: "bytes",
+			Input: struct {
+				Default      []byte            `hcl:"default"`
+				UTF8         []byte            `hcl:"utf8" hcle:"bytes=utf8"`
+				Base64       []byte            `hcl:"base64" hcle:"bytes=base64"`
+				Base64Decode []byte            `hcl:"base64decode" hcle:"bytes=base64decode"`
+				Hex          []byte            `hcl:"hex" hcle:"bytes=hex"`
+				Map          map[string][]byte `hcl:"map" hcle:"bytes=hex"`
+				Empty        []byte            `hcl:"empty"`
+				Nil          []byte            `hcl:"nil"`
+				Array        [2]byte           `hcl:"array"`
+				IP           net.IP            `hcl:"ip"`
+				IPHex        net.IP            `hcl:"ip_hex" hcle:"bytes=hex"`
+				IPs          []net.IP          `hcl:"ips"`
+			}{
+				Default:      hello,
+				UTF8:         hello,
+				Base64:       hello,
+				Base64Decode: hello,
+				Hex:          hello,
+				Map:          map[string][]byte{"key": hello},
+				Empty:        []byte{},
+				Array:        [2]byte{1, 2},
+				IP:           net.IPv4(10, 0, 0, 1).To4(),
+				IPHex:        net.IPv4(10, 0, 0, 1).To4(),
+				IPs:          []net.IP{net.ParseIP("::1")},
+			},
+			Output: "bytes",
+		},
+		encoderTest2{
+			ID: "invalid utf8 bytes",
+			Input: struct {
+				UTF8 []byte `hcl:"utf8" hcle:"bytes=utf8"`
+			}{[]byte{0xff}},
+			Error: true,
+		},
+		encoderTest2{
+			ID: "invalid bytes encoding",
+			Input: struct {
+				Bytes []byte `hcl:"bytes" hcle:"bytes=base32"`
+			}{hello},
+			Error: true,
+		},
+	)
+
+	tests = append(tests, encoderTest2{
+		ID: "literal",
+		Input: struct {
+			String     string    `hcl:"string" hcle:"literal"`
+			Expression string    `hcl:"expression,expr" hcle:"literal"`
+			Cty        cty.Value `hcl:"cty" hcle:"literal"`
+			Template   cty.Value `hcl:"template"`
+		}{
+			String:     "pa${ss}",
+			Expression: "%{ if true }pass%{ endif }",
+			Cty:        cty.MapVal(map[string]cty.Value{"${key}": cty.StringVal("pa${ss}")}),
+			Template:   cty.StringVal("pa${ss}"),
+		},
+		Output: "literal",
+	})
+
+	tests = append(tests, encoderTest2{
+		ID: "preserve cty types",
+		Input: struct {
+			List cty.Value `hcl:"list"`
+			Set  cty.Value `hcl:"set" hcle:"literal"`
+			Map  cty.Value `hcl:"map"`
+		}{
+			List: cty.ListVal([]cty.Value{cty.StringVal("a")}),
+			Set:  cty.SetVal([]cty.Value{cty.StringVal("${b}"), cty.StringVal("${a}")}),
+			Map:  cty.MapValEmpty(cty.String),
+		},
+		Options: []Option{WithValueOptions(PreserveTypes())},
+		Output:  "preserve-cty-types",
+	})
+
+	tests = append(tests,
+		encoderTest2{
+			ID: "unknown cty values",
+			Input: struct {
+				ID       cty.Value `hcl:"id"`
+				Password cty.Value `hcl:"password"`
+				Tags     cty.Value `hcl:"tags"`
+			}{
+				ID:       cty.UnknownVal(cty.String),
+				Password: cty.StringVal("secret").Mark("sensitive"),
+				Tags:     cty.ListVal([]cty.Value{cty.StringVal("a"), cty.UnknownVal(cty.String)}),
+			},
+			Options: []Option{WithValueOptions(OmitUnknowns())},
+			Output:  "unknown-cty-values",
+		},
+		encoderTest2{
+			ID: "nested unknown cty values",
+			Input: struct {
+				ID      cty.Value                  `hcl:"id" hcle:"null"`
+				Objects []struct{ V, W cty.Value } `hcl:"objs"`
+				Meta    map[string]cty.Value       `hcl:"meta,block"`
+				Extra   map[string]cty.Value       `hcl:",remain"`
+			}{
+				ID:      cty.UnknownVal(cty.String),
+				Objects: []struct{ V, W cty.Value }{{V: cty.UnknownVal(cty.String), W: cty.StringVal("w")}},
+				Meta:    map[string]cty.Value{"x": cty.UnknownVal(cty.String), "y": cty.StringVal("y")},
+				Extra:   map[string]cty.Value{"x": cty.UnknownVal(cty.String), "z": cty.StringVal("z")},
+			},
+			Options: []Option{WithValueOptions(OmitUnknowns())},
+			Output:  "nested-unknown-cty-values",
+		},
+		encoderTest2{
+			ID: "unknown cty value",
+			Input: struct {
+				ID cty.Value `hcl:"id"`
+			}{cty.UnknownVal(cty.String)},
+			Error: true,
+		},
+	)
+
+	rule := func(port int64) cty.Value {
+		return cty.ObjectVal(map[string]cty.Value{
+			"port":  cty.NumberIntVal(port),
+			"cidrs": cty.ListVal([]cty.Value{cty.StringVal("10.0.0.0/8")}),
+		})
+	}
+	tests = append(tests,
+		encoderTest2{
+			ID: "cty blocks",
+			Input: struct {
+				Settings cty.Value            `hcl:"settings,block"`
+				Ingress  cty.Value            `hcl:"ingress,blocks"`
+				Egress   cty.Value            `hcl:"egress,blocks"`
+				Empty    cty.Value            `hcl:"empty,blocks"`
+				Null     cty.Value            `hcl:"null,block"`
+				Unknown  cty.Value            `hcl:"unknown,blocks"`
+				Disks    []struct{ Size int } `hcl:"disk,blocks"`
+				Rules    cty.Value            `hcl:"rules"`
+			}{
+				Settings: cty.ObjectVal(map[string]cty.Value{
+					"name":    cty.StringVal("web"),
+					"id":      cty.UnknownVal(cty.String),
+					"enabled": cty.True.Mark("sensitive"),
+				}),
+				Ingress: cty.ListVal([]cty.Value{rule(80), rule(443)}),
+				Egress: cty.MapVal(map[string]cty.Value{
+					"all": rule(0),
+				}),
+				Empty:   cty.ListValEmpty(rule(0).Type()),
+				Null:    cty.NullVal(rule(0).Type()),
+				Unknown: cty.UnknownVal(cty.List(rule(0).Type())),
+				Disks:   []struct{ Size int }{},
+				Rules:   cty.TupleVal([]cty.Value{rule(22)}),
+			},
+			Options: []Option{WithValueOptions(OmitUnknowns())},
+			Output:  "cty-blocks",
+		},
+		encoderTest2{
+			ID: "cty blocks of strings",
+			Input: struct {
+				Ingress cty.Value `hcl:"ingress,blocks"`
+			}{cty.ListVal([]cty.Value{cty.StringVal("80")})},
+			Error: true,
+		},
+		encoderTest2{
+			ID: "literal and marked cty blocks",
+			Input: struct {
+				Secret  cty.Value `hcl:"secret,block" hcle:"literal"`
+				Ingress cty.Value `hcl:"ingress,blocks" hcle:"literal"`
+			}{
+				Secret: cty.ObjectVal(map[string]cty.Value{
+					"password": cty.StringVal("pa${ss}"),
+				}).Mark("sensitive"),
+				Ingress: cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+					"description": cty.StringVal("%{ if x }"),
+				})}).Mark("sensitive"),
+			},
+			Output: "literal-cty-blocks",
+		},
+		encoderTest2{
+			ID: "marked cty map block",
+			Input: struct {
+				Tags cty.Value `hcl:"tags,block"`
+			}{cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod")}).Mark("sensitive")},
+			ErrorMessage: "tags: the keys of marked maps can't be written as attribute names",
+		},
+		encoderTest2{
+			ID: "marked cty map blocks",
+			Input: struct {
+				Rules cty.Value `hcl:"rule,blocks"`
+			}{cty.MapVal(map[string]cty.Value{"ssh": rule(22)}).Mark("sensitive")},
+			ErrorMessage: "rule: the keys of marked maps can't be written as labels",
+		},
+		encoderTest2{
+			ID: "unknown cty block",
+			Input: struct {
+				Ingress cty.Value `hcl:"ingress,block"`
+			}{cty.UnknownVal(rule(0).Type())},
+			Error: true,
+		},
+	)
+
+	cyclicMap := map[string]interface{}{}
+	cyclicMap["self"] = cyclicMap
+	var cyclicInterface interface{}
+	cyclicInterface = &cyclicInterface
+	tests = append(tests,
+		encoderTest2{
+			ID:           "pointer cycle",
+			Input:        networks(true),
+			ErrorMessage: "encoding cycle: network.subnet[0].network refers back to network",
+		},
+		encoderTest2{
+			ID: "map cycle",
+			Input: struct {
+				Map map[string]interface{} `hcl:"map"`
+			}{cyclicMap},
+			ErrorMessage: "encoding cycle: map[\"self\"] refers back to map",
+		},
+		encoderTest2{
+			ID: "interface cycle",
+			Input: struct {
+				A interface{}
+			}{cyclicInterface},
+			ErrorMessage: "encoding cycle: A refers back to A",
+		},
+		encoderTest2{
+			ID:     "shared pointers",
+			Input:  networks(false),
+			Output: "shared-pointers",
+		},
+		encoderTest2{
+			ID:           "max depth",
+			Input:        networks(false),
+			Options:      []Option{MaxDepth(3)},
+			ErrorMessage: "subnet[0].network.name: maximum depth of 3 exceeded",
+		},
+		encoderTest2{
+			ID:      "within max depth",
+			Input:   networks(false),
+			Options: []Option{MaxDepth(4)},
+			Output:  "shared-pointers",
+		},
+	)
+
 	for _, test := range tests {
-		actual, err := Encode(test.Input)
-		if err != nil {
-			t.Error(err)
-		}
+		actual, err := Encode(test.Input, test.Options...)
 
-		if test.Error {
+		if test.ErrorMessage != "" {
+			assert.EqualError(t, err, test.ErrorMessage, test.ID)
+		} else if test.Error {
 			assert.Error(t, err, test.ID)
 		} else {
 			expected, ferr := ioutil.ReadFile(fmt.Sprintf("_tests/%s.hcl", test.Output))
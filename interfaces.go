@@ -0,0 +1,44 @@
+package hclencoder
+
+import (
+	"reflect"
+)
+
+// BlockTyper is implemented by types that name their own blocks, overriding the name given by the parent field. This
+// allows a block list of interfaces to hold different types of blocks, or a generic type to compute its block type.
+type BlockTyper interface {
+	HCLBlockType() string
+}
+
+// BlockLabeler is implemented by types that compute their own block labels. The labels replace any labels from key
+// fields.
+type BlockLabeler interface {
+	HCLLabels() []string
+}
+
+// implementation returns the value, or its pointer if addressable, as an interface{} if it implements iface.
+func implementation(in reflect.Value, iface reflect.Type) (interface{}, bool) {
+	if in.CanInterface() && in.Type().Implements(iface) {
+		return in.Interface(), true
+	}
+	if in.CanAddr() && in.Addr().CanInterface() && in.Addr().Type().Implements(iface) {
+		return in.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// blockType returns the type of the block encoding a struct, which is name unless the struct implements BlockTyper.
+func blockType(in reflect.Value, name string) string {
+	if typer, ok := implementation(in, reflect.TypeOf((*BlockTyper)(nil)).Elem()); ok {
+		return typer.(BlockTyper).HCLBlockType()
+	}
+	return name
+}
+
+// blockLabels returns the labels of the block encoding a struct if the struct implements BlockLabeler.
+func blockLabels(in reflect.Value) ([]string, bool) {
+	if labeler, ok := implementation(in, reflect.TypeOf((*BlockLabeler)(nil)).Elem()); ok {
+		return labeler.(BlockLabeler).HCLLabels(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,78 @@
+// Code generated by hclencoder-gen; DO NOT EDIT.
+
+package gentest
+
+import (
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/multy-dev/hclencoder"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// EncodeHCL implements hclencoder.Marshaler.
+func (v Config) EncodeHCL(enc *hclencoder.Encoder, blockType string) (*hclwrite.Block, error) {
+	block := hclwrite.NewBlock(blockType, nil)
+	if err := enc.AppendField(block, "Farm", `hcl:",squash"`, &v.Farm); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Farmer", `hcl:"farmer"`, &v.Farmer); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Owner", `hcl:"owner"`, &v.Owner); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Animals", `hcl:"animal,blocks"`, &v.Animals); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Buildings", `hcl:"buildings"`, &v.Buildings); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Extra", `hcl:"extra" hcle:"omitempty"`, &v.Extra); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// EncodeHCL implements hclencoder.Marshaler.
+func (v Farm) EncodeHCL(enc *hclencoder.Encoder, blockType string) (*hclwrite.Block, error) {
+	block := hclwrite.NewBlock(blockType, nil)
+	block.Body().SetAttributeRaw("name", hclwrite.TokensForValue(cty.StringVal(v.Name)))
+	block.Body().SetAttributeRaw("owned", hclwrite.TokensForValue(cty.BoolVal(v.Owned)))
+	if err := enc.AppendField(block, "Location", `hcl:"location" hcle:"group=land"`, &v.Location); err != nil {
+		return nil, err
+	}
+	if v.Acres != 0 {
+		block.Body().SetAttributeRaw("acres", hclwrite.TokensForValue(cty.NumberUIntVal(uint64(v.Acres))))
+	}
+	return block, nil
+}
+
+// EncodeHCL implements hclencoder.Marshaler.
+func (v Farmer) EncodeHCL(enc *hclencoder.Encoder, blockType string) (*hclwrite.Block, error) {
+	block := hclwrite.NewBlock(blockType, nil)
+	block.Body().SetAttributeRaw("age", hclwrite.TokensForValue(cty.NumberIntVal(int64(v.Age))))
+	if tokens, err := hclencoder.ExpressionTokens(v.Name); err != nil {
+		return nil, err
+	} else {
+		block.Body().SetAttributeRaw("name", tokens)
+	}
+	if err := enc.AppendField(block, "Height", ``, &v.Height); err != nil {
+		return nil, err
+	}
+	if err := enc.AppendField(block, "Extra", `hcl:",remain"`, &v.Extra); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// EncodeHCL implements hclencoder.Marshaler.
+func (v Animal) EncodeHCL(enc *hclencoder.Encoder, blockType string) (*hclwrite.Block, error) {
+	block := hclwrite.NewBlock(blockType, nil)
+	block.SetLabels(append(block.Labels(), v.Name))
+	if v.Sound != "" {
+		block.Body().SetAttributeRaw("says", hclwrite.TokensForValue(cty.StringVal(v.Sound)))
+	}
+	if v.Legs != 0 {
+		block.Body().SetAttributeRaw("legs", hclwrite.TokensForValue(cty.NumberIntVal(int64(v.Legs))))
+	}
+	return block, nil
+}
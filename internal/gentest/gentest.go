@@ -0,0 +1,36 @@
+// Package gentest holds types with EncodeHCL methods generated by hclencoder-gen, used to check that generated
+// marshalers encode exactly like the reflective encoder.
+package gentest
+
+//go:generate go run ../../cmd/hclencoder-gen -type=Config,Farm,Farmer,Animal
+
+type Farm struct {
+	Name     string    `hcl:"name"`
+	Owned    bool      `hcl:"owned"`
+	Location []float64 `hcl:"location" hcle:"group=land"`
+	Acres    uint16    `hcl:"acres" hcle:"omitempty,group=land"`
+}
+
+type Farmer struct {
+	Extra                map[string]interface{} `hcl:",remain"`
+	Name                 string                 `hcl:"name,expr"`
+	Age                  int                    `hcl:"age" hcle:"order=-1"`
+	Height               float64
+	SocialSecurityNumber string `hcle:"omit"`
+}
+
+type Animal struct {
+	Name  string `hcl:",key"`
+	Sound string `hcl:"says" hcle:"omitempty"`
+	Legs  int8   `hcl:"legs" hcle:"omitempty"`
+}
+
+type Config struct {
+	Farm      `hcl:",squash"`
+	Farmer    Farmer            `hcl:"farmer"`
+	Owner     *Farmer           `hcl:"owner"`
+	Animals   []Animal          `hcl:"animal,blocks"`
+	Buildings map[string]string `hcl:"buildings"`
+	Extra     interface{}       `hcl:"extra" hcle:"omitempty"`
+	Unused    []string          `hcl:",unusedKeys"`
+}
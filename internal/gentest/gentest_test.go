@@ -0,0 +1,98 @@
+package gentest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/multy-dev/hclencoder"
+	"github.com/stretchr/testify/assert"
+)
+
+// the reflect* types have the same fields as the generated types but none of their methods, so encoding them goes
+// through the reflective encoder.
+type (
+	reflectConfig Config
+	reflectFarm   Farm
+	reflectFarmer Farmer
+	reflectAnimal Animal
+)
+
+func TestGeneratedMatchesReflection(t *testing.T) {
+	farmer := Farmer{
+		Extra: map[string]interface{}{
+			"nickname": "Old MacDonald",
+			"tractor":  struct{ Make string }{"Deere"},
+		},
+		Name:                 "var.name",
+		Age:                  65,
+		Height:               1.85,
+		SocialSecurityNumber: "please-dont-share-me",
+	}
+	config := Config{
+		Farm: Farm{
+			Name:     "Ol' McDonald's ${farm}",
+			Owned:    true,
+			Location: []float64{12.34, -5.67},
+		},
+		Farmer: farmer,
+		Owner:  &farmer,
+		Animals: []Animal{
+			{Name: "cow", Sound: "moo", Legs: 4},
+			{Name: "rock"},
+		},
+		Buildings: map[string]string{
+			"House": "123 Numbers Lane",
+			"Barn":  "456 Digits Drive",
+		},
+		Extra:  []string{"foo"},
+		Unused: []string{"bar"},
+	}
+
+	tests := []struct {
+		generated interface{}
+		reflected interface{}
+	}{
+		{config, reflectConfig(config)},
+		{&config, (*reflectConfig)(&config)},
+		{Config{}, reflectConfig{}},
+		{struct{ Farm Farm }{config.Farm}, struct{ Farm reflectFarm }{reflectFarm(config.Farm)}},
+		{struct{ Farmer Farmer }{farmer}, struct{ Farmer reflectFarmer }{reflectFarmer(farmer)}},
+		{
+			struct {
+				Animals []Animal `hcl:"animal,blocks"`
+			}{config.Animals},
+			struct {
+				Animals []reflectAnimal `hcl:"animal,blocks"`
+			}{[]reflectAnimal{reflectAnimal(config.Animals[0]), reflectAnimal(config.Animals[1])}},
+		},
+	}
+
+	options := [][]hclencoder.Option{
+		nil,
+		{hclencoder.AttributesFirst()},
+		{hclencoder.WithLayout(hclencoder.TerraformLayout)},
+		{hclencoder.SeparateBlocks(), hclencoder.SeparateNestedBlocks()},
+		{hclencoder.FloatPrecision(3)},
+		{hclencoder.MaxDepth(1)},
+		{hclencoder.MaxDepth(2)},
+		{hclencoder.MaxDepth(3)},
+	}
+
+	for j, opts := range options {
+		for i, test := range tests {
+			msg := fmt.Sprintf("test %d with options %d", i, j)
+			expected, expectedErr := hclencoder.Encode(test.reflected, opts...)
+			actual, err := hclencoder.Encode(test.generated, opts...)
+			assert.Equal(t, expectedErr, err, msg)
+			assert.Equal(t, string(expected), string(actual), msg)
+		}
+	}
+}
+
+func TestGeneratedRemainCollision(t *testing.T) {
+	farmer := Farmer{Extra: map[string]interface{}{"Height": 2}}
+	_, expected := hclencoder.Encode(reflectFarmer(farmer))
+	_, err := hclencoder.Encode(farmer)
+	assert.EqualError(t, expected, `remain key "Height" collides with field Height`)
+	assert.Equal(t, expected, err)
+}
@@ -0,0 +1,229 @@
+package hclencoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"reflect"
+	"sort"
+)
+
+// JSONSchemaVersion is the JSON Schema draft JSONSchema describes configs with.
+const JSONSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema derives a JSON Schema describing the HCL JSON form of the configs Encode writes for a struct type, from
+// its Spec. Attributes are described by their value types, accepting null like HCL does, and blocks by objects keyed
+// by each of their labels down to their bodies, which can be arrays of bodies for block lists sharing their labels.
+func JSONSchema(t reflect.Type) ([]byte, error) {
+	spec, err := Spec(t)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := bodyJSONSchema(spec)
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = JSONSchemaVersion
+	schema["title"] = indirectType(t).Name()
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+type jsonSchema map[string]interface{}
+
+// bodyJSONSchema describes a body decoded with spec as a JSON object.
+func bodyJSONSchema(spec hcldec.Spec) (jsonSchema, error) {
+	properties := jsonSchema{}
+	var required []string
+	if err := addJSONProperties(properties, &required, spec); err != nil {
+		return nil, err
+	}
+
+	schema := jsonSchema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// addJSONProperties adds a property for each attribute and block type spec reads from a body, listing the required
+// ones.
+func addJSONProperties(properties jsonSchema, required *[]string, spec hcldec.Spec) error {
+	var (
+		name       string
+		property   jsonSchema
+		isRequired bool
+		err        error
+	)
+	switch s := spec.(type) {
+	case hcldec.ObjectSpec:
+		for _, child := range s {
+			if err := addJSONProperties(properties, required, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case hcldec.TupleSpec:
+		for _, child := range s {
+			if err := addJSONProperties(properties, required, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *hcldec.AttrSpec:
+		name, property, isRequired = s.Name, typeJSONSchema(s.Type), s.Required
+	case *hcldec.DefaultSpec:
+		if err := addJSONProperties(properties, required, s.Primary); err != nil {
+			return err
+		}
+		return addJSONDefault(properties, s)
+	case *hcldec.ValidateSpec:
+		return addJSONProperties(properties, required, s.Wrapped)
+	case *hcldec.BlockSpec:
+		name, isRequired = s.TypeName, s.Required
+		property, err = blockJSONSchema(s, s.Nested, false)
+	case *hcldec.BlockListSpec:
+		name, isRequired = s.TypeName, s.MinItems > 0
+		property, err = blockJSONSchema(s, s.Nested, true)
+	case *hcldec.BlockTupleSpec:
+		name, isRequired = s.TypeName, s.MinItems > 0
+		property, err = blockJSONSchema(s, s.Nested, true)
+	case *hcldec.BlockSetSpec:
+		name, isRequired = s.TypeName, s.MinItems > 0
+		property, err = blockJSONSchema(s, s.Nested, true)
+	case *hcldec.BlockMapSpec:
+		name = s.TypeName
+		property, err = blockJSONSchema(s, s.Nested, false)
+	case *hcldec.BlockObjectSpec:
+		name = s.TypeName
+		property, err = blockJSONSchema(s, s.Nested, false)
+	case *hcldec.BlockAttrsSpec:
+		name, isRequired = s.TypeName, s.Required
+		property = jsonSchema{
+			"type":                 "object",
+			"additionalProperties": typeJSONSchema(s.ElementType),
+		}
+	case *hcldec.BlockLabelSpec, *hcldec.LiteralSpec, *hcldec.ExprSpec:
+		// labels are described by the block, and the others don't come from the body
+		return nil
+	default:
+		return fmt.Errorf("unsupported spec %T", spec)
+	}
+	if err != nil {
+		return err
+	}
+
+	properties[name] = property
+	if isRequired {
+		*required = append(*required, name)
+	}
+	return nil
+}
+
+// addJSONDefault documents the literal default of an attribute.
+func addJSONDefault(properties jsonSchema, spec *hcldec.DefaultSpec) error {
+	attr, ok := spec.Primary.(*hcldec.AttrSpec)
+	literal, isLiteral := spec.Default.(*hcldec.LiteralSpec)
+	if !ok || !isLiteral {
+		return nil
+	}
+	def, err := ctyjson.Marshal(literal.Value, literal.Value.Type())
+	if err != nil {
+		return fmt.Errorf("default of %s: %v", attr.Name, err)
+	}
+	properties[attr.Name].(jsonSchema)["default"] = json.RawMessage(def)
+	return nil
+}
+
+// blockJSONSchema describes the blocks read by spec in the HCL JSON form: an object keyed by each label, nested down
+// to the body. Repeated blocks sharing their labels are given as an array of bodies.
+func blockJSONSchema(spec hcldec.Spec, nested hcldec.Spec, repeated bool) (jsonSchema, error) {
+	schema, err := bodyJSONSchema(nested)
+	if err != nil {
+		return nil, err
+	}
+	if repeated {
+		schema = repeatableJSONSchema(schema)
+	}
+
+	labels := hcldec.ImpliedSchema(spec).Blocks[0].LabelNames
+	for i := len(labels) - 1; i >= 0; i-- {
+		schema = jsonSchema{
+			"type":                 "object",
+			"description":          fmt.Sprintf("keyed by %s", labels[i]),
+			"additionalProperties": schema,
+		}
+	}
+	return schema, nil
+}
+
+func repeatableJSONSchema(schema jsonSchema) jsonSchema {
+	// HCL also accepts arrays at the levels of labels, which are left out to keep schemas small
+	return jsonSchema{"anyOf": []jsonSchema{
+		schema,
+		{"type": "array", "items": schema},
+	}}
+}
+
+// typeJSONSchema describes the JSON values of a cty type. Values of any type are described by an empty schema.
+func typeJSONSchema(ty cty.Type) jsonSchema {
+	switch {
+	case ty == cty.String:
+		return nullableJSONSchema("string")
+	case ty == cty.Number:
+		return nullableJSONSchema("number")
+	case ty == cty.Bool:
+		return nullableJSONSchema("boolean")
+	case ty.IsListType():
+		schema := nullableJSONSchema("array")
+		schema["items"] = typeJSONSchema(ty.ElementType())
+		return schema
+	case ty.IsSetType():
+		schema := nullableJSONSchema("array")
+		schema["items"] = typeJSONSchema(ty.ElementType())
+		schema["uniqueItems"] = true
+		return schema
+	case ty.IsTupleType():
+		var items []jsonSchema
+		for _, elem := range ty.TupleElementTypes() {
+			items = append(items, typeJSONSchema(elem))
+		}
+		schema := nullableJSONSchema("array")
+		schema["items"] = items
+		schema["minItems"] = len(items)
+		schema["maxItems"] = len(items)
+		return schema
+	case ty.IsMapType():
+		schema := nullableJSONSchema("object")
+		schema["additionalProperties"] = typeJSONSchema(ty.ElementType())
+		return schema
+	case ty.IsObjectType():
+		properties := jsonSchema{}
+		var required []string
+		for name, attr := range ty.AttributeTypes() {
+			properties[name] = typeJSONSchema(attr)
+			if !ty.AttributeOptional(name) {
+				required = append(required, name)
+			}
+		}
+		schema := nullableJSONSchema("object")
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+		return schema
+	}
+	return jsonSchema{}
+}
+
+func nullableJSONSchema(typeName string) jsonSchema {
+	return jsonSchema{"type": []string{typeName, "null"}}
+}
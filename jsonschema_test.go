@@ -0,0 +1,62 @@
+package hclencoder
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+type jsonSchemaConfig struct {
+	Name    string                  `hcl:"name"`
+	Image   string                  `hcl:"image,expr"`
+	Labels  []string                `hcl:"labels"`
+	Ports   []schemaPort            `hcl:"port,blocks"`
+	Mounts  []schemaMount           `hcl:"mount,blocks"`
+	Volumes map[string]schemaVolume `hcl:"volume,blocks"`
+	Owner   *struct {
+		Email string `hcl:"email"`
+	} `hcl:"owner"`
+	Checks []struct {
+		Path     string `hcl:"path"`
+		Interval int    `hcl:"interval" hcle:"omitzero"`
+	} `hcl:"checks"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	actual, err := JSONSchema(reflect.TypeOf(jsonSchemaConfig{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	expected, err := ioutil.ReadFile("_tests/json-schema.json")
+	if err != nil {
+		t.Fatal("could not read output JSON: ", err)
+	}
+	assert.JSONEq(t, string(expected), string(actual))
+
+	_, err = JSONSchema(reflect.TypeOf(schemaRemain{}))
+	assert.Error(t, err)
+}
+
+// TestJSONSchemaForm checks that configs shaped like the schema decode with the Spec it's derived from.
+func TestJSONSchemaForm(t *testing.T) {
+	spec, err := Spec(reflect.TypeOf(jsonSchemaConfig{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	file, diags := hcljson.Parse([]byte(`{
+		"name": "web",
+		"image": "nginx",
+		"port": [{"number": 80}, {"number": 53, "protocol": "udp"}],
+		"mount": {"data": {"/data": {"read_only": true}}},
+		"volume": {"cache": {"path": "/var/cache"}},
+		"checks": [{"path": "/health"}]
+	}`), "config.json")
+	if !assert.False(t, diags.HasErrors(), diags.Error()) {
+		return
+	}
+	_, diags = hcldec.Decode(file.Body, spec, nil)
+	assert.False(t, diags.HasErrors(), diags.Error())
+}
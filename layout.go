@@ -0,0 +1,277 @@
+package hclencoder
+
+import (
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Layout rearranges the body of a block once all of its fields are encoded.
+type Layout func(block *hclwrite.Block)
+
+// bodyItem is an attribute, a nested block or unstructured tokens of a body.
+type bodyItem struct {
+	name   string
+	attr   *hclwrite.Attribute
+	block  *hclwrite.Block
+	tokens hclwrite.Tokens
+}
+
+func (i bodyItem) isBlock() bool {
+	return i.block != nil
+}
+
+// isBlankLine reports whether an item is only made of newlines.
+func (i bodyItem) isBlankLine() bool {
+	if i.attr != nil || i.block != nil {
+		return false
+	}
+	for _, tkn := range i.tokens {
+		if tkn.Type != hclsyntax.TokenNewline {
+			return false
+		}
+	}
+	return true
+}
+
+// bodyItems returns the items of a body in the order they're written. hclwrite doesn't expose the order of
+// attributes, so it's recovered from the position of their tokens in the body.
+func bodyItems(body *hclwrite.Body) []bodyItem {
+	starts := map[*hclwrite.Token]bodyItem{}
+	lengths := map[*hclwrite.Token]int{}
+	for name, attr := range body.Attributes() {
+		tkns := attr.BuildTokens(nil)
+		starts[tkns[0]] = bodyItem{name: name, attr: attr}
+		lengths[tkns[0]] = len(tkns)
+	}
+	for _, block := range body.Blocks() {
+		tkns := block.BuildTokens(nil)
+		starts[tkns[0]] = bodyItem{name: block.Type(), block: block}
+		lengths[tkns[0]] = len(tkns)
+	}
+
+	var items []bodyItem
+	var unstructured hclwrite.Tokens
+	tkns := body.BuildTokens(nil)
+	for i := 0; i < len(tkns); {
+		item, ok := starts[tkns[i]]
+		if !ok {
+			unstructured = append(unstructured, tkns[i])
+			i++
+			continue
+		}
+		if unstructured != nil {
+			items = append(items, bodyItem{tokens: unstructured})
+			unstructured = nil
+		}
+		items = append(items, item)
+		i += lengths[tkns[i]]
+	}
+	if unstructured != nil {
+		items = append(items, bodyItem{tokens: unstructured})
+	}
+	return items
+}
+
+// appendBodyItems appends items to a body, keeping attributes and blocks structured.
+func appendBodyItems(body *hclwrite.Body, items []bodyItem) {
+	for _, item := range items {
+		switch {
+		case item.attr != nil:
+			body.SetAttributeRaw(item.name, item.attr.Expr().BuildTokens(nil))
+		case item.block != nil:
+			body.AppendBlock(item.block)
+		default:
+			body.AppendUnstructuredTokens(item.tokens)
+		}
+	}
+}
+
+// squashBlock lifts the attributes and blocks of innerBlock into body. Blank lines are dropped, since they're laid out
+// again along with the rest of body.
+func squashBlock(innerBlock *hclwrite.Block, body *hclwrite.Body) {
+	for _, item := range bodyItems(innerBlock.Body()) {
+		if !item.isBlankLine() {
+			appendBodyItems(body, []bodyItem{item})
+		}
+	}
+}
+
+// layout reorders the items of a block encoded from a struct of type t according to the encoder's options, and
+// separates them with blank lines. A block without a type is the root of the file, which is separated by Encode.
+func (e *Encoder) layout(block *hclwrite.Block, t reflect.Type) {
+	if e.attributesFirst {
+		attributesFirst(block)
+	}
+	groupAttributes(block.Body(), fieldGroups(t))
+	if e.customLayout != nil {
+		e.customLayout(block)
+	}
+	if e.separateNestedBlocks && block.Type() != "" {
+		separateBlocks(block.Body())
+	}
+}
+
+// attributesFirst moves the attributes of a block before its nested blocks.
+func attributesFirst(block *hclwrite.Block) {
+
+	var attributes, blocks []bodyItem
+	for _, item := range bodyItems(block.Body()) {
+		if item.isBlock() {
+			blocks = append(blocks, item)
+		} else {
+			attributes = append(attributes, item)
+		}
+	}
+
+	clearBody(block.Body())
+	appendBodyItems(block.Body(), append(attributes, blocks...))
+}
+
+// fieldGroupsCache holds the results of fieldGroups by struct type, so tags aren't parsed again for every block.
+var fieldGroupsCache sync.Map
+
+// fieldGroups maps the names of the fields of a struct type to their GroupTag, including those of squashed structs.
+// Blocks without a struct type, such as those of cty.Values, have a nil type and no groups. The map is cached by type
+// and must not be modified.
+func fieldGroups(t reflect.Type) map[string]string {
+	if t == nil {
+		return nil
+	}
+	if groups, ok := fieldGroupsCache.Load(t); ok {
+		return groups.(map[string]string)
+	}
+
+	groups := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		meta := extractFieldMeta(t.Field(i))
+		fieldType := t.Field(i).Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if meta.squash && fieldType.Kind() == reflect.Struct {
+			for name, group := range fieldGroups(fieldType) {
+				groups[name] = group
+			}
+		} else if meta.group != "" {
+			groups[meta.name] = meta.group
+		}
+	}
+	fieldGroupsCache.Store(t, groups)
+	return groups
+}
+
+// groupAttributes inserts a blank line between consecutive attributes of different groups. Attributes without a group
+// form a group of their own.
+func groupAttributes(body *hclwrite.Body, groups map[string]string) {
+	if len(groups) == 0 {
+		return
+	}
+
+	var items []bodyItem
+	var group string
+	seen := false
+	for _, item := range bodyItems(body) {
+		if item.attr != nil {
+			if seen && groups[item.name] != group && !items[len(items)-1].isBlankLine() {
+				items = append(items, blankLine())
+			}
+			group, seen = groups[item.name], true
+		}
+		items = append(items, item)
+	}
+
+	clearBody(body)
+	appendBodyItems(body, items)
+}
+
+// separateBlocks inserts a blank line before every block of a body that doesn't start it.
+func separateBlocks(body *hclwrite.Body) {
+	var items []bodyItem
+	for _, item := range bodyItems(body) {
+		if item.isBlock() && len(items) > 0 && !items[len(items)-1].isBlankLine() {
+			items = append(items, blankLine())
+		}
+		items = append(items, item)
+	}
+
+	clearBody(body)
+	appendBodyItems(body, items)
+}
+
+func blankLine() bodyItem {
+	return bodyItem{tokens: hclwrite.Tokens{{
+		Type:  hclsyntax.TokenNewline,
+		Bytes: []byte("\n"),
+	}}}
+}
+
+// terraformMetaArguments are the arguments Terraform accepts in every resource and module block, in the order its style
+// guide lists them.
+var terraformMetaArguments = []string{"count", "for_each", "provider", "depends_on"}
+
+// TerraformLayout follows the Terraform style guide: meta-arguments come first, separated from the other attributes by
+// a blank line, every nested block is preceded by a blank line and lifecycle blocks come last. Blank lines from
+// GroupTag are replaced by its own.
+func TerraformLayout(block *hclwrite.Block) {
+	var metaArguments, attributes, blocks, lifecycle []bodyItem
+	for _, item := range bodyItems(block.Body()) {
+		switch {
+		case item.isBlankLine():
+			// blank lines are added back below
+		case item.isBlock() && item.name == "lifecycle":
+			lifecycle = append(lifecycle, item)
+		case item.isBlock():
+			blocks = append(blocks, item)
+		case item.attr != nil && metaArgumentIndex(item.name) >= 0:
+			metaArguments = append(metaArguments, item)
+		default:
+			attributes = append(attributes, item)
+		}
+	}
+	sort.SliceStable(metaArguments, func(i, j int) bool {
+		return metaArgumentIndex(metaArguments[i].name) < metaArgumentIndex(metaArguments[j].name)
+	})
+
+	groups := [][]bodyItem{metaArguments, attributes}
+	for _, item := range append(blocks, lifecycle...) {
+		groups = append(groups, []bodyItem{item})
+	}
+
+	body := block.Body()
+	clearBody(body)
+	first := true
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		if !first {
+			body.AppendNewline()
+		}
+		appendBodyItems(body, group)
+		first = false
+	}
+}
+
+func metaArgumentIndex(name string) int {
+	for i, arg := range terraformMetaArguments {
+		if arg == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// clearBody removes every item from a body. Body.Clear isn't enough, since it leaves the attributes behind for
+// SetAttributeRaw to find.
+func clearBody(body *hclwrite.Body) {
+	for name := range body.Attributes() {
+		body.RemoveAttribute(name)
+	}
+	for _, block := range body.Blocks() {
+		body.RemoveBlock(block)
+	}
+	body.Clear()
+}
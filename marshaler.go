@@ -0,0 +1,50 @@
+package hclencoder
+
+import (
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"reflect"
+)
+
+// Marshaler is implemented by types that can encode themselves into an HCL block without reflection. Implementations
+// are usually generated by cmd/hclencoder-gen, and Encode prefers them over the reflective encoder whenever a struct
+// value implements it, unless the method is promoted from an embedded field or the block's fields would exceed
+// MaxDepth.
+type Marshaler interface {
+	// EncodeHCL returns the block for the value. blockType is the block name given by the parent field, and enc
+	// encodes any fields the implementation doesn't handle directly.
+	EncodeHCL(enc *Encoder, blockType string) (*hclwrite.Block, error)
+}
+
+// AppendField encodes the struct field pointed to by field into block, exactly as the reflective encoder would have.
+// name is the name of the field in Go, which is used when the tag doesn't override it.
+func (e *Encoder) AppendField(block *hclwrite.Block, name string, tag reflect.StructTag, field interface{}) error {
+	rawVal := reflect.ValueOf(field).Elem()
+	return e.encodeStructField(block, reflect.StructField{
+		Name: name,
+		Type: rawVal.Type(),
+		Tag:  tag,
+	}, rawVal)
+}
+
+// ExpressionTokens converts a string into the tokens of an unquoted expression, as done for fields with the
+// `hcl:",expr"` tag.
+func ExpressionTokens(expr string) (hclwrite.Tokens, error) {
+	return tokenizeExpression(expr, "")
+}
+
+// marshalerFor returns the Marshaler implemented by the value or, if addressable, by its pointer. Structs embedding a
+// Marshaler are never considered one themselves, since a promoted EncodeHCL would only encode the embedded value.
+func marshalerFor(in reflect.Value) (Marshaler, bool) {
+	marshalerType := reflect.TypeOf((*Marshaler)(nil)).Elem()
+	for i := 0; i < in.NumField(); i++ {
+		field := in.Type().Field(i)
+		if field.Anonymous && (field.Type.Implements(marshalerType) || reflect.PtrTo(field.Type).Implements(marshalerType)) {
+			return nil, false
+		}
+	}
+
+	if m, ok := implementation(in, marshalerType); ok {
+		return m.(Marshaler), true
+	}
+	return nil, false
+}
@@ -1,12 +1,17 @@
 package hclencoder
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -28,6 +33,16 @@ const (
 	// a list.
 	Blocks string = "blocks"
 
+	// Block is attached to a map and indicates that the map should be
+	// encoded as a nested block with an attribute for each key, rather
+	// than an object.
+	Block string = "block"
+
+	// RemainTag is attached to a map and indicates that its entries
+	// should be merged into the enclosing block as attributes, or nested
+	// blocks for struct values.
+	RemainTag string = "remain"
+
 	// Expression indicates that this field should not be quoted.
 	Expression string = "expr"
 
@@ -49,22 +64,74 @@ const (
 	// behavior to `json:"-"`.
 	OmitTag string = "omit"
 
-	// OmitEmptyTag will omit this field if it is a zero value. This
+	// OmitEmptyTag will omit this field if it is a zero value, an empty
+	// string, slice or map, or a struct whose fields are all empty. This
 	// is similar behavior to `json:",omitempty"`
 	OmitEmptyTag string = "omitempty"
+
+	// OmitZeroTag will omit this field if it is a zero value, as reported
+	// by its IsZero() bool method if it has one. This is similar behavior
+	// to `json:",omitzero"`
+	OmitZeroTag string = "omitzero"
+
+	// DefaultTag declares the default value of a primitive field, as in
+	// `hcle:"default=80"`. The field is omitted if it equals its default.
+	DefaultTag string = "default"
+
+	// OrderTag sets the position of a field within its block, as in
+	// `hcle:"order=-1"`. Fields are sorted by order, then by declaration,
+	// and default to an order of 0.
+	OrderTag string = "order"
+
+	// GroupTag puts an attribute into a named group, as in
+	// `hcle:"group=network"`. A blank line separates consecutive
+	// attributes of different groups.
+	GroupTag string = "group"
+
+	// NullTag will encode this field as `null` if it is a nil pointer,
+	// interface, map or slice, instead of omitting it. OmitEmptyTag takes
+	// precedence over this tag.
+	NullTag string = "null"
+
+	// BytesTag selects how a byte slice is encoded, as in
+	// `hcle:"bytes=hex"`: BytesUTF8, BytesBase64, BytesBase64Decode or
+	// BytesHex. Byte slices are base64 encoded by default, like
+	// encoding/json does.
+	BytesTag string = "bytes"
+
+	// LiteralTag escapes template sequences in the strings of this
+	// field, including those of cty.Values, so that untrusted data can
+	// never be interpreted as a template. It takes precedence over the
+	// expr tag.
+	LiteralTag string = "literal"
 )
 
+var ctyValueType = reflect.TypeOf(cty.Value{})
+
 type fieldMeta struct {
 	anonymous     bool
 	name          string
 	key           bool
 	squash        bool
 	repeatBlock   bool
+	block         bool
+	remain        bool
 	expression    bool
 	unusedKeys    bool
 	decodedFields bool
 	omit          bool
 	omitEmpty     bool
+	omitZero      bool
+	hasDefault    bool
+	defaultValue  string
+	null          bool
+	order         int
+	group         string
+	bytes         string
+	literal       bool
+
+	// err records a malformed tag, reported when the field is encoded.
+	err error
 }
 
 type node struct {
@@ -90,59 +157,73 @@ func (n node) isTokens() bool {
 	return n.Tokens != nil
 }
 
-func encode(in reflect.Value) (node *node, err error) {
-	return encodeField(in, fieldMeta{})
+func (e *Encoder) encode(in reflect.Value) (node *node, err error) {
+	return e.encodeField(in, fieldMeta{})
 }
 
 // encode converts a reflected valued into an HCL ast.node in a depth-first manner.
-func encodeField(in reflect.Value, meta fieldMeta) (node *node, err error) {
-	in, isNil := deref(in)
-	if isNil {
-		return nil, nil
+func (e *Encoder) encodeField(in reflect.Value, meta fieldMeta) (node *node, err error) {
+	in, isNil, err := e.deref(in)
+	if err != nil || isNil {
+		return nil, err
 	}
 
+	leave, err := e.enter(in)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
 	switch in.Kind() {
 
-	case reflect.Bool, reflect.Float64, reflect.String,
-		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+	case reflect.Bool, reflect.Float32, reflect.Float64, reflect.String,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return encodePrimitive(in, meta)
+		return e.encodePrimitive(in, meta)
 
-	case reflect.Slice:
-		return encodeList(in, meta)
+	case reflect.Slice, reflect.Array:
+		return e.encodeList(in, meta)
 
 	case reflect.Map:
-		return encodePrimitive(in, meta)
+		if meta.repeatBlock {
+			return e.encodeBlockMap(in, meta)
+		}
+		if meta.block {
+			return e.encodeMapBlock(in, meta)
+		}
+		return e.encodePrimitive(in, meta)
 
 	case reflect.Struct:
-		if in.Type().AssignableTo(reflect.TypeOf(cty.Value{})) {
-			meta.expression = true
-			str, _ := ValueToString(in.Interface().(cty.Value))
-			return encodePrimitive(reflect.ValueOf(str), meta)
+		if in.Type() == ctyValueType {
+			return e.encodeCtyValue(in, meta)
+		}
+		if isNumberStruct(in.Type()) {
+			return e.encodePrimitive(in, meta)
 		}
-		return encodeStruct(in, meta)
+		return e.encodeStruct(in, meta)
 	default:
-		return nil, fmt.Errorf("cannot encode kind %s to HCL", in.Kind())
+		return nil, e.unsupportedKind(in)
 	}
 }
 
+// unsupportedKind reports a value HCL has no type for, such as a channel, a function, a complex number or an unsafe
+// pointer.
+func (e *Encoder) unsupportedKind(in reflect.Value) error {
+	return fmt.Errorf("%s: cannot encode %s to HCL", e.pathString(len(e.path)), in.Type())
+}
+
 // encodePrimitive converts a primitive value into a node contains its tokens
-func encodePrimitive(in reflect.Value, meta fieldMeta) (*node, error) {
-	// Keys must be literals, so we don't tokenize.
-	if meta.key {
-		k := cty.StringVal(in.String())
-		return &node{Value: &k}, nil
-	}
-	tkn, err := tokenize(in, meta)
-	if err != nil {
+func (e *Encoder) encodePrimitive(in reflect.Value, meta fieldMeta) (*node, error) {
+	tkn, err := e.tokenize(in, meta)
+	if err != nil || tkn == nil {
 		return nil, err
 	}
 
 	return &node{Tokens: tkn}, nil
 }
 
-// encodeList converts a slice into either a block list or a primitive list depending on its element type
-func encodeList(in reflect.Value, meta fieldMeta) (*node, error) {
+// encodeList converts a slice or an array into either a block list or a primitive list depending on its element type
+func (e *Encoder) encodeList(in reflect.Value, meta fieldMeta) (*node, error) {
 	childType := in.Type().Elem()
 
 childLoop:
@@ -156,119 +237,518 @@ childLoop:
 	}
 
 	switch childType.Kind() {
-	case reflect.Map, reflect.Struct, reflect.Interface:
-		return encodeBlockList(in, meta)
+	case reflect.Map, reflect.Struct, reflect.Interface, reflect.Slice, reflect.Array:
+		return e.encodeBlockList(in, meta)
 	default:
-		return encodePrimitiveList(in, meta)
+		return e.encodePrimitiveList(in, meta)
 	}
 }
 
 // encodePrimitiveList converts a slice of primitive values to an ast.ListType. An
 // ast.ObjectKey is never returned.
-func encodePrimitiveList(in reflect.Value, meta fieldMeta) (*node, error) {
-	return encodePrimitive(in, meta)
+func (e *Encoder) encodePrimitiveList(in reflect.Value, meta fieldMeta) (*node, error) {
+	return e.encodePrimitive(in, meta)
 }
 
 // encodeBlockList converts a slice of non-primitive types to an ast.ObjectList. An
-// ast.ObjectKey is never returned.
-func encodeBlockList(in reflect.Value, meta fieldMeta) (*node, error) {
-	var blocks []*hclwrite.Block
+// ast.ObjectKey is never returned. Interfaces and pointers are dereferenced, nested
+// slices are flattened and nil elements are skipped.
+func (e *Encoder) encodeBlockList(in reflect.Value, meta fieldMeta) (*node, error) {
+	// an empty list of blocks is still a list of blocks, not a missing value
+	blocks := []*hclwrite.Block{}
 
 	if !meta.repeatBlock {
-		return encodePrimitiveList(in, meta)
+		return e.encodePrimitiveList(in, meta)
 	}
 
 	for i := 0; i < in.Len(); i++ {
-		node, err := encodeStruct(in.Index(i), meta)
+		val, isNil, err := e.deref(in.Index(i))
 		if err != nil {
 			return nil, err
 		}
-		if node == nil {
+		if isNil {
 			continue
 		}
+		if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+			if err := e.push(indexSegment(i)); err != nil {
+				return nil, err
+			}
+			node, err := e.encodeNestedBlockList(val, meta)
+			e.pop()
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, node.BlockList...)
+			continue
+		}
+		if val.Kind() != reflect.Struct || val.Type() == ctyValueType {
+			return nil, fmt.Errorf("block lists must contain structs, %s given", val.Type())
+		}
+
+		if err := e.push(indexSegment(i)); err != nil {
+			return nil, err
+		}
+		node, err := e.encodeStruct(val, meta)
+		e.pop()
+		if err != nil {
+			return nil, err
+		}
 		blocks = append(blocks, node.Block)
 	}
 
 	return &node{BlockList: blocks}, nil
 }
 
-// encodeStruct converts a struct type into a block
-func encodeStruct(in reflect.Value, parentMeta fieldMeta) (*node, error) {
-	l := in.NumField()
-	block := hclwrite.NewBlock(parentMeta.name, nil)
+// encodeNestedBlockList flattens a slice found within a block list into its blocks.
+func (e *Encoder) encodeNestedBlockList(in reflect.Value, meta fieldMeta) (*node, error) {
+	leave, err := e.enter(in)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+	return e.encodeBlockList(in, meta)
+}
 
-	for i := 0; i < l; i++ {
-		field := in.Type().Field(i)
-		meta := extractFieldMeta(field)
+// encodeBlockMap converts a map of structs, or of maps of structs, into a block list. The map keys become the labels of
+// the blocks, in sorted order, ahead of the labels from the structs' key fields.
+func (e *Encoder) encodeBlockMap(in reflect.Value, meta fieldMeta) (*node, error) {
+	blocks, err := e.appendMapBlocks(nil, in, meta, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &node{BlockList: blocks}, nil
+}
+
+func (e *Encoder) appendMapBlocks(blocks []*hclwrite.Block, in reflect.Value, meta fieldMeta, labels []string) ([]*hclwrite.Block, error) {
+	if keyType := in.Type().Key().Kind(); keyType != reflect.String {
+		return nil, fmt.Errorf("map keys must be strings, %s given", keyType)
+	}
 
-		// these tags are used for debugging the decoder
-		// they should not be output
-		if meta.unusedKeys || meta.decodedFields || meta.omit {
+	for _, k := range sortedMapKeys(in) {
+		val, isNil, err := e.deref(in.MapIndex(k))
+		if err != nil {
+			return nil, err
+		}
+		if isNil {
 			continue
 		}
 
-		// if the OmitEmptyTag is provided, check if the value is its zero value.
-		rawVal := in.Field(i)
-		if meta.omitEmpty {
-			zeroVal := reflect.Zero(rawVal.Type()).Interface()
-			if reflect.DeepEqual(rawVal.Interface(), zeroVal) {
-				continue
+		if err := e.push(keySegment(k.String())); err != nil {
+			return nil, err
+		}
+		keyLabels := append(labels[:len(labels):len(labels)], k.String())
+		switch {
+		case val.Kind() == reflect.Map:
+			leave, err := e.enter(val)
+			if err != nil {
+				return nil, err
+			}
+			blocks, err = e.appendMapBlocks(blocks, val, meta, keyLabels)
+			leave()
+			if err != nil {
+				return nil, err
+			}
+		case val.Kind() == reflect.Struct && val.Type() != ctyValueType:
+			node, err := e.encodeStruct(val, meta)
+			if err != nil {
+				return nil, err
 			}
+			node.Block.SetLabels(append(keyLabels, node.Block.Labels()...))
+			blocks = append(blocks, node.Block)
+		default:
+			return nil, fmt.Errorf("block maps must contain structs or maps of structs, %s given", val.Type())
 		}
+		e.pop()
+	}
+
+	return blocks, nil
+}
+
+// encodeMapBlock converts a map into a single block with an attribute for each key, in sorted order.
+func (e *Encoder) encodeMapBlock(in reflect.Value, meta fieldMeta) (*node, error) {
+	if keyType := in.Type().Key().Kind(); keyType != reflect.String {
+		return nil, fmt.Errorf("map keys must be strings, %s given", keyType)
+	}
 
-		val, err := encodeField(rawVal, meta)
+	block := hclwrite.NewBlock(meta.name, nil)
+	for _, k := range sortedMapKeys(in) {
+		if !hclsyntax.ValidIdentifier(k.String()) {
+			return nil, fmt.Errorf("map key %q is not a valid attribute name", k.String())
+		}
+		val, isNil, err := e.deref(in.MapIndex(k))
 		if err != nil {
 			return nil, err
 		}
-		if val == nil {
+		if isNil {
 			continue
 		}
+		tkns, ok, err := e.tokenizeEntry(keySegment(k.String()), val, meta)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			block.Body().SetAttributeRaw(k.String(), tkns)
+		}
+	}
+
+	return &node{Block: block}, nil
+}
+
+// encodeStruct converts a struct type into a block. The block is named after the parent field and labeled by the key
+// fields, unless the struct implements BlockTyper or BlockLabeler.
+func (e *Encoder) encodeStruct(in reflect.Value, parentMeta fieldMeta) (*node, error) {
+	leave, err := e.enter(in)
+	if err != nil {
+		return nil, err
+	}
+	defer leave()
+
+	var block *hclwrite.Block
+	name := blockType(in, parentMeta.name)
+
+	// squashed structs are merged into the struct they're squashed into, so their remain keys are checked against its
+	// fields instead
+	outer := e.structType
+	if !parentMeta.squash || outer == nil {
+		e.structType = in.Type()
+	}
+	defer func() {
+		e.structType = outer
+	}()
+
+	// Marshalers write primitive fields without descending into them, so blocks whose fields are past MaxDepth are
+	// encoded reflectively to fail the same way
+	if m, ok := marshalerFor(in); ok && (e.maxDepth == 0 || len(e.path) < e.maxDepth) {
+		if block, err = m.EncodeHCL(e, name); err != nil {
+			return nil, err
+		}
+	} else {
+		block = hclwrite.NewBlock(name, nil)
+		for _, i := range fieldOrder(in.Type()) {
+			if err := e.encodeStructField(block, in.Type().Field(i), in.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if labels, ok := blockLabels(in); ok {
+		block.SetLabels(labels)
+	}
+	e.layout(block, in.Type())
+
+	return &node{Block: block}, nil
+}
+
+// encodeStructField encodes a single struct field into block, either as a label, an attribute or nested blocks
+func (e *Encoder) encodeStructField(block *hclwrite.Block, field reflect.StructField, rawVal reflect.Value) error {
+	meta := extractFieldMeta(field)
+
+	// a null attribute can't stand in for missing blocks
+	if meta.null && isBlockField(field.Type, meta) {
+		return fmt.Errorf("field %s: the null tag only applies to attributes, not to blocks", meta.name)
+	}
+
+	if skip, err := skipField(rawVal, meta); err != nil || skip {
+		return err
+	}
+
+	if meta.remain {
+		return e.encodeRemain(block, rawVal, meta)
+	}
+
+	if err := e.push(meta.name); err != nil {
+		return err
+	}
+	defer e.pop()
+
+	// this field is a key and should be bubbled up to the parent node
+	if meta.key {
+		labels, err := e.encodeLabels(rawVal)
+		if err != nil {
+			return err
+		}
+		block.SetLabels(append(block.Labels(), labels...))
+		return nil
+	}
 
-		// this field is a key and should be bubbled up to the parent node
-		if meta.key {
-			if val.isValue() && (*val.Value).Type() == cty.String {
-				label := (*val.Value).AsString()
+	val, err := e.encodeField(rawVal, meta)
+	if err != nil {
+		return err
+	}
+	if val == nil {
+		// only nil values are written as null, unknown values omitted with OmitUnknowns stay omitted
+		if _, isNil, _ := deref(rawVal); isNil && meta.null {
+			block.Body().SetAttributeRaw(meta.name, hclwrite.TokensForValue(cty.NullVal(cty.DynamicPseudoType)))
+		}
+		return nil
+	}
+
+	if meta.squash && !val.isBlock() {
+		return errors.New("squash fields must be structs")
+	}
+
+	if val.isBlock() {
+		if meta.squash {
+			squashBlock(val.Block, block.Body())
+			for _, label := range val.Block.Labels() {
 				block.SetLabels(append(block.Labels(), label))
-				continue
 			}
-			return nil, errors.New("struct key fields must be string literals")
+		} else {
+			block.Body().AppendBlock(val.Block)
 		}
+	} else if val.isBlockList() {
+		for _, innerBlock := range val.BlockList {
+			block.Body().AppendBlock(innerBlock)
+		}
+	} else if val.isValue() {
+		block.Body().SetAttributeValue(meta.name, *val.Value)
+	} else if val.isTokens() {
+		block.Body().SetAttributeRaw(meta.name, val.Tokens)
+	} else {
+		return errors.New("unknown value type")
+	}
 
-		if meta.squash && !val.isBlock() {
-			return nil, errors.New("squash fields must be structs")
+	return nil
+}
+
+// encodeRemain merges the entries of a map into block, as attributes or as nested blocks for struct values.
+func (e *Encoder) encodeRemain(block *hclwrite.Block, in reflect.Value, meta fieldMeta) error {
+	names, values, err := e.remainEntries(in)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]string
+	if e.structType != nil {
+		fields = fieldNames(e.structType)
+	}
+	for i, name := range names {
+		if field, ok := fields[name]; ok {
+			return fmt.Errorf("remain key %q collides with field %s", name, field)
+		}
+		// remain keys of squashed structs have already been merged into the block
+		if block.Body().GetAttribute(name) != nil || len(blocksOfType(block.Body(), name)) > 0 {
+			return fmt.Errorf("remain key %q collides with an attribute or block", name)
 		}
 
-		if val.isBlock() {
-			if meta.squash {
-				squashBlock(val.Block, block.Body())
-				for _, label := range val.Block.Labels() {
-					block.SetLabels(append(block.Labels(), label))
-				}
-			} else {
-				block.Body().AppendBlock(val.Block)
+		if values[i].Kind() == reflect.Struct && values[i].Type() != ctyValueType {
+			if err := e.push(name); err != nil {
+				return err
+			}
+			node, err := e.encodeStruct(values[i], fieldMeta{name: name})
+			e.pop()
+			if err != nil {
+				return err
 			}
+			block.Body().AppendBlock(node.Block)
+			continue
+		}
+		tkns, ok, err := e.tokenizeEntry(name, values[i], meta)
+		if err != nil {
+			return err
+		}
+		if ok {
+			block.Body().SetAttributeRaw(name, tkns)
+		}
+	}
+
+	return nil
+}
+
+// remainEntries returns the keys of a remain field in sorted order, along with their dereferenced values. Nil values
+// are left out.
+func (e *Encoder) remainEntries(in reflect.Value) (names []string, values []reflect.Value, err error) {
+	in, isNil, err := e.deref(in)
+	if err != nil || isNil {
+		return nil, nil, err
+	}
+	if in.Kind() != reflect.Map || in.Type().Key().Kind() != reflect.String {
+		return nil, nil, fmt.Errorf("remain fields must be maps with string keys, %s given", in.Type())
+	}
+
+	for _, k := range sortedMapKeys(in) {
+		if !hclsyntax.ValidIdentifier(k.String()) {
+			return nil, nil, fmt.Errorf("map key %q is not a valid attribute name", k.String())
+		}
+		val, isNil, err := e.deref(in.MapIndex(k))
+		if err != nil {
+			return nil, nil, err
+		}
+		if isNil {
 			continue
-		} else if val.isBlockList() {
-			for _, innerBlock := range val.BlockList {
-				block.Body().AppendBlock(innerBlock)
+		}
+		names = append(names, k.String())
+		values = append(values, val)
+	}
+	return names, values, nil
+}
+
+// isBlockField reports whether a struct field is encoded as blocks rather than as an attribute, from its type and tags.
+// Interfaces are only known to hold blocks once encoded.
+func isBlockField(t reflect.Type, meta fieldMeta) bool {
+	t = indirectType(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == ctyValueType {
+			return meta.block || meta.repeatBlock
+		}
+		return !isNumberStruct(t)
+	case reflect.Map:
+		return meta.block || meta.repeatBlock
+	case reflect.Slice, reflect.Array:
+		_, ok := blockListElem(t)
+		return ok && meta.repeatBlock
+	}
+	return false
+}
+
+// fieldNamesCache holds the results of fieldNames by struct type.
+var fieldNamesCache sync.Map
+
+// fieldNames maps the names of the attributes and blocks encoded from the fields of a struct type, including those of
+// squashed structs, to the names of the fields in Go. Fields are named whether or not their values are left out. The
+// map is cached by type and must not be modified.
+func fieldNames(t reflect.Type) map[string]string {
+	if names, ok := fieldNamesCache.Load(t); ok {
+		return names.(map[string]string)
+	}
+
+	names := map[string]string{}
+	addFieldNames(names, t, map[reflect.Type]bool{})
+	fieldNamesCache.Store(t, names)
+	return names
+}
+
+func addFieldNames(names map[string]string, t reflect.Type, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		meta := extractFieldMeta(field)
+		switch {
+		case meta.unusedKeys || meta.decodedFields || meta.omit || meta.key || meta.remain:
+		case meta.squash:
+			if squashed := indirectType(field.Type); squashed.Kind() == reflect.Struct {
+				addFieldNames(names, squashed, seen)
 			}
-		} else if val.isValue() {
-			block.Body().SetAttributeValue(meta.name, *val.Value)
-		} else if val.isTokens() {
-			block.Body().SetAttributeRaw(meta.name, val.Tokens)
+		default:
+			names[meta.name] = field.Name
+		}
+	}
+}
+
+// blocksOfType returns the blocks of a body with the given type.
+func blocksOfType(body *hclwrite.Body, typeName string) []*hclwrite.Block {
+	var blocks []*hclwrite.Block
+	for _, block := range body.Blocks() {
+		if block.Type() == typeName {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// fieldOrderCache holds the results of fieldOrder by struct type, so tags aren't parsed again for every block.
+var fieldOrderCache sync.Map
+
+// fieldOrder returns the indices of the fields of a struct type in the order they're encoded, sorted by their
+// OrderTag and then by declaration. Remain fields are encoded last so they can be checked against every other field.
+// The slice is cached by type and must not be modified.
+func fieldOrder(t reflect.Type) []int {
+	if order, ok := fieldOrderCache.Load(t); ok {
+		return order.([]int)
+	}
+
+	var order, remain []int
+	metas := make([]fieldMeta, t.NumField())
+	for i := range metas {
+		metas[i] = extractFieldMeta(t.Field(i))
+		if metas[i].remain {
+			remain = append(remain, i)
 		} else {
-			return nil, errors.New("unknown value type")
+			order = append(order, i)
 		}
+	}
 
+	order = append(order, remain...)
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := metas[order[i]], metas[order[j]]
+		if a.remain != b.remain {
+			return b.remain
+		}
+		return a.order < b.order
+	})
+	fieldOrderCache.Store(t, order)
+	return order
+}
+
+// encodeLabels converts a key field into block labels. Keys can be strings, integers, encoding.TextMarshalers or
+// fmt.Stringers, or slices of them contributing one label per element.
+func (e *Encoder) encodeLabels(in reflect.Value) ([]string, error) {
+	in, isNil, err := e.deref(in)
+	if err != nil || isNil {
+		return nil, err
 	}
 
-	return &node{Block: block}, nil
+	label, ok, err := encodeLabel(in)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return []string{label}, nil
+	}
+
+	if in.Kind() != reflect.Slice && in.Kind() != reflect.Array {
+		return nil, fmt.Errorf("struct key fields must be strings, integers, encoding.TextMarshalers or fmt.Stringers, %s given", in.Type())
+	}
+	var labels []string
+	for i := 0; i < in.Len(); i++ {
+		elemLabels, err := e.encodeLabels(in.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, elemLabels...)
+	}
+	return labels, nil
 }
 
-func squashBlock(innerBlock *hclwrite.Block, block *hclwrite.Body) {
-	tkns := innerBlock.Body().BuildTokens(nil)
-	block.AppendUnstructuredTokens(tkns)
+// encodeLabel converts a single value into a label, reporting whether it has a type that can be used as one.
+func encodeLabel(in reflect.Value) (string, bool, error) {
+	if m, ok := implementation(in, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()); ok {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		return string(text), true, err
+	}
+	if in.Kind() == reflect.String {
+		return in.String(), true, nil
+	}
+	if s, ok := implementation(in, reflect.TypeOf((*fmt.Stringer)(nil)).Elem()); ok {
+		return s.(fmt.Stringer).String(), true, nil
+	}
 
+	switch in.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(in.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(in.Uint(), 10), true, nil
+	}
+	return "", false, nil
+}
+
+// skipField reports whether a struct field is left out of the output, for both blocks and objects.
+func skipField(rawVal reflect.Value, meta fieldMeta) (bool, error) {
+	if meta.err != nil {
+		return false, meta.err
+	}
+
+	// these tags are used for debugging the decoder
+	// they should not be output
+	if meta.unusedKeys || meta.decodedFields || meta.omit {
+		return true, nil
+	}
+
+	return shouldOmit(rawVal, meta)
 }
 
 // extractFieldMeta pulls information about struct fields and the optional HCL tags
@@ -298,6 +778,10 @@ func extractFieldMeta(f reflect.StructField) (meta fieldMeta) {
 				meta.unusedKeys = true
 			case Blocks:
 				meta.repeatBlock = true
+			case Block:
+				meta.block = true
+			case RemainTag:
+				meta.remain = true
 			case Expression:
 				meta.expression = true
 			}
@@ -311,27 +795,86 @@ func extractFieldMeta(f reflect.StructField) (meta fieldMeta) {
 			meta.omit = true
 		case OmitEmptyTag:
 			meta.omitEmpty = true
+		case OmitZeroTag:
+			meta.omitZero = true
+		case NullTag:
+			meta.null = true
+		case LiteralTag:
+			meta.literal = true
+		default:
+			if strings.HasPrefix(tag, DefaultTag+"=") {
+				meta.hasDefault = true
+				meta.defaultValue = strings.TrimPrefix(tag, DefaultTag+"=")
+			} else if strings.HasPrefix(tag, OrderTag+"=") {
+				order, err := strconv.Atoi(strings.TrimPrefix(tag, OrderTag+"="))
+				if err != nil {
+					meta.err = fmt.Errorf("field %s: invalid order: %v", meta.name, err)
+				}
+				meta.order = order
+			} else if strings.HasPrefix(tag, GroupTag+"=") {
+				meta.group = strings.TrimPrefix(tag, GroupTag+"=")
+			} else if strings.HasPrefix(tag, BytesTag+"=") {
+				meta.bytes = strings.TrimPrefix(tag, BytesTag+"=")
+				if !validBytesEncoding(meta.bytes) {
+					meta.err = fmt.Errorf("field %s: invalid bytes encoding %q", meta.name, meta.bytes)
+				}
+			}
 		}
 	}
 
 	return
 }
 
+// sortedMapKeys returns the keys of a map with string keys in sorted order.
+func sortedMapKeys(in reflect.Value) []reflect.Value {
+	keys := in.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// errPointerCycle is returned by deref for pointers and interfaces leading back to themselves, which never reach a
+// value to encode.
+var errPointerCycle = errors.New("pointers refer back to themselves")
+
 // deref safely dereferences interface and pointer values to their underlying value types.
 // It also detects if that value is invalid or nil.
-func deref(in reflect.Value) (val reflect.Value, isNil bool) {
-	switch in.Kind() {
-	case reflect.Invalid:
-		return in, true
-	case reflect.Interface, reflect.Ptr:
-		if in.IsNil() {
-			return in, true
-		}
-		// recurse for the elusive double pointer
-		return deref(in.Elem())
-	case reflect.Slice, reflect.Map:
-		return in, in.IsNil()
-	default:
-		return in, false
+func deref(in reflect.Value) (val reflect.Value, isNil bool, err error) {
+	// the pointers followed so far, for the elusive double pointer
+	var buf [4]uintptr
+	followed := buf[:0]
+	for {
+		switch in.Kind() {
+		case reflect.Invalid:
+			return in, true, nil
+		case reflect.Interface, reflect.Ptr:
+			if in.IsNil() {
+				return in, true, nil
+			}
+			if in.Kind() == reflect.Ptr {
+				for _, ptr := range followed {
+					if ptr == in.Pointer() {
+						return in, false, errPointerCycle
+					}
+				}
+				followed = append(followed, in.Pointer())
+			}
+			in = in.Elem()
+		case reflect.Slice, reflect.Map:
+			return in, in.IsNil(), nil
+		default:
+			return in, false, nil
+		}
+	}
+}
+
+// deref dereferences a value like the deref function, naming the path of a pointer cycle in its error.
+func (e *Encoder) deref(in reflect.Value) (val reflect.Value, isNil bool, err error) {
+	val, isNil, err = deref(in)
+	if err == errPointerCycle {
+		path := e.pathString(len(e.path))
+		return val, isNil, fmt.Errorf("encoding cycle: %s refers back to %s", path, path)
 	}
+	return val, isNil, err
 }
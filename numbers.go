@@ -0,0 +1,86 @@
+package hclencoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+var (
+	bigIntType     = reflect.TypeOf(big.Int{})
+	bigFloatType   = reflect.TypeOf(big.Float{})
+	jsonNumberType = reflect.TypeOf(json.Number(""))
+)
+
+// isNumberStruct reports whether a struct type is encoded as a number rather than as an object or a block.
+func isNumberStruct(t reflect.Type) bool {
+	return t == bigIntType || t == bigFloatType
+}
+
+// tokenizeFloat converts a float32 or a float64 into a number, in its shortest form that converts back to the same
+// float, or with the digits set by FloatPrecision. NaN and infinities have no HCL representation.
+func (e *Encoder) tokenizeFloat(in reflect.Value) (hclwrite.Tokens, error) {
+	f := in.Float()
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("%s: cannot encode %v to HCL", e.pathString(len(e.path)), f)
+	}
+
+	precision := -1
+	if e.fixedFloats {
+		precision = e.floatPrecision
+	}
+	return numberTokens(strconv.FormatFloat(f, 'f', precision, in.Type().Bits())), nil
+}
+
+// tokenizeBigNumber converts a big.Int or a big.Float into a number, without losing any precision.
+func (e *Encoder) tokenizeBigNumber(in reflect.Value) (hclwrite.Tokens, error) {
+	switch n := addressOf(in).(type) {
+	case *big.Int:
+		return numberTokens(n.String()), nil
+	case *big.Float:
+		if n.IsInf() {
+			return nil, fmt.Errorf("%s: cannot encode %v to HCL", e.pathString(len(e.path)), n)
+		}
+		precision := -1
+		if e.fixedFloats {
+			precision = e.floatPrecision
+		}
+		return numberTokens(n.Text('f', precision)), nil
+	}
+	return nil, e.unsupportedKind(in)
+}
+
+// tokenizeJSONNumber converts a json.Number into a number. Like encoding/json, an empty json.Number is encoded as 0.
+func (e *Encoder) tokenizeJSONNumber(in reflect.Value) (hclwrite.Tokens, error) {
+	if in.String() == "" {
+		return numberTokens("0"), nil
+	}
+	val, err := cty.ParseNumberVal(in.String())
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid number %q: %v", e.pathString(len(e.path)), in.String(), err)
+	}
+	return hclwrite.TokensForValue(val), nil
+}
+
+func numberTokens(s string) hclwrite.Tokens {
+	return hclwrite.Tokens{{
+		Type:  hclsyntax.TokenNumberLit,
+		Bytes: []byte(s),
+	}}
+}
+
+// addressOf returns a pointer to a value, copying it if it isn't addressable.
+func addressOf(in reflect.Value) interface{} {
+	if in.CanAddr() {
+		return in.Addr().Interface()
+	}
+	ptr := reflect.New(in.Type())
+	ptr.Elem().Set(in)
+	return ptr.Interface()
+}
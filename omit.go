@@ -0,0 +1,109 @@
+package hclencoder
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// zeroer is implemented by types that define their own zero value, such as time.Time.
+type zeroer interface {
+	IsZero() bool
+}
+
+// shouldOmit reports whether a field should be left out of the output according to its OmitEmptyTag, OmitZeroTag and
+// DefaultTag.
+func shouldOmit(in reflect.Value, meta fieldMeta) (bool, error) {
+	if meta.omitEmpty && isEmpty(in) {
+		return true, nil
+	}
+	if meta.omitZero && isZero(in) {
+		return true, nil
+	}
+	if meta.hasDefault {
+		return isDefault(in, meta)
+	}
+	return false, nil
+}
+
+// isZero reports whether a value is zero, using its IsZero method if it has one.
+func isZero(in reflect.Value) bool {
+	if (in.Kind() == reflect.Ptr || in.Kind() == reflect.Interface) && in.IsNil() {
+		return true
+	}
+	if z, ok := implementation(in, reflect.TypeOf((*zeroer)(nil)).Elem()); ok {
+		return z.(zeroer).IsZero()
+	}
+	return in.IsZero()
+}
+
+// isEmpty reports whether a value is zero, an empty string or collection, or a struct whose fields are all empty. Values
+// with an IsZero method are only empty when it reports them as zero.
+func isEmpty(in reflect.Value) bool {
+	if isZero(in) {
+		return true
+	}
+	if _, ok := implementation(in, reflect.TypeOf((*zeroer)(nil)).Elem()); ok {
+		return false
+	}
+
+	switch in.Kind() {
+	case reflect.Bool:
+		return !in.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return in.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return in.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return in.Float() == 0
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return in.Len() == 0
+	case reflect.Struct:
+		for i := 0; i < in.NumField(); i++ {
+			if !isEmpty(in.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isDefault reports whether a primitive value is equal to the default declared with DefaultTag.
+func isDefault(in reflect.Value, meta fieldMeta) (bool, error) {
+	in, isNil, err := deref(in)
+	if err != nil {
+		return false, fmt.Errorf("field %s: encoding cycle: %v", meta.name, err)
+	}
+	if isNil {
+		return false, nil
+	}
+
+	var equal bool
+	switch in.Kind() {
+	case reflect.String:
+		equal = in.String() == meta.defaultValue
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(meta.defaultValue)
+		equal = in.Bool() == b
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(meta.defaultValue, 0, 64)
+		equal = in.Int() == i
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(meta.defaultValue, 0, 64)
+		equal = in.Uint() == u
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(meta.defaultValue, in.Type().Bits())
+		equal = in.Float() == f
+	default:
+		return false, fmt.Errorf("field %s: default values are only supported for primitive types, %s given", meta.name, in.Kind())
+	}
+	if err != nil {
+		return false, fmt.Errorf("field %s: invalid default value %q: %v", meta.name, meta.defaultValue, err)
+	}
+	return equal, nil
+}
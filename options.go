@@ -0,0 +1,58 @@
+package hclencoder
+
+// Option configures an Encoder.
+type Option func(*Encoder)
+
+// AttributesFirst places the attributes of every block before its nested blocks, regardless of the order of the
+// fields they come from.
+func AttributesFirst() Option {
+	return func(e *Encoder) {
+		e.attributesFirst = true
+	}
+}
+
+// WithLayout applies layout to every block once its fields are encoded, after AttributesFirst if both are given.
+// TerraformLayout is provided for Terraform configurations.
+func WithLayout(layout Layout) Option {
+	return func(e *Encoder) {
+		e.customLayout = layout
+	}
+}
+
+// SeparateBlocks inserts a blank line before every top-level block that follows another attribute or block.
+func SeparateBlocks() Option {
+	return func(e *Encoder) {
+		e.separateBlocks = true
+	}
+}
+
+// SeparateNestedBlocks inserts a blank line before every nested block that follows another attribute or block.
+func SeparateNestedBlocks() Option {
+	return func(e *Encoder) {
+		e.separateNestedBlocks = true
+	}
+}
+
+// MaxDepth limits how deeply fields, elements and map entries can be nested, returning an error naming the path that
+// exceeds it. Cycles are always reported, regardless of this limit.
+func MaxDepth(depth int) Option {
+	return func(e *Encoder) {
+		e.maxDepth = depth
+	}
+}
+
+// FloatPrecision formats floats with a fixed number of digits after the decimal point, instead of the shortest form
+// that converts back to the same float.
+func FloatPrecision(digits int) Option {
+	return func(e *Encoder) {
+		e.fixedFloats = true
+		e.floatPrecision = digits
+	}
+}
+
+// WithValueOptions renders cty.Value fields with opts, as ValueToString does.
+func WithValueOptions(opts ...ValueOption) Option {
+	return func(e *Encoder) {
+		e.valueOptions = append(e.valueOptions, opts...)
+	}
+}
@@ -0,0 +1,96 @@
+package hclencoder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// visit identifies a struct, map or slice being encoded. The type tells apart a struct from its first field.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// push descends into a field, element or map key of the value being encoded, failing if the path grows deeper than
+// the MaxDepth option allows.
+func (e *Encoder) push(segment string) error {
+	e.path = append(e.path, segment)
+	if e.maxDepth > 0 && len(e.path) > e.maxDepth {
+		err := fmt.Errorf("%s: maximum depth of %d exceeded", e.pathString(len(e.path)), e.maxDepth)
+		e.pop()
+		return err
+	}
+	return nil
+}
+
+// pop returns from the last segment pushed.
+func (e *Encoder) pop() {
+	e.path = e.path[:len(e.path)-1]
+}
+
+// enter marks a value as being encoded until leave is called, failing if it's already being encoded further up the
+// path. Values entered again at the same depth are the same node handed between encoding functions, not a cycle.
+func (e *Encoder) enter(in reflect.Value) (leave func(), err error) {
+	v, ok := visitOf(in)
+	if !ok {
+		return func() {}, nil
+	}
+	if depth, visiting := e.visiting[v]; visiting {
+		if depth == len(e.path) {
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("encoding cycle: %s refers back to %s", e.pathString(len(e.path)), e.pathString(depth))
+	}
+
+	if e.visiting == nil {
+		e.visiting = map[visit]int{}
+	}
+	e.visiting[v] = len(e.path)
+	return func() {
+		delete(e.visiting, v)
+	}, nil
+}
+
+// visitOf identifies the values that can be part of a cycle: structs behind a pointer, maps and non-empty slices.
+func visitOf(in reflect.Value) (visit, bool) {
+	switch in.Kind() {
+	case reflect.Struct:
+		if in.CanAddr() {
+			return visit{ptr: in.UnsafeAddr(), typ: in.Type()}, true
+		}
+	case reflect.Map:
+		if !in.IsNil() {
+			return visit{ptr: in.Pointer(), typ: in.Type()}, true
+		}
+	case reflect.Slice:
+		if in.Len() > 0 {
+			return visit{ptr: in.Pointer(), typ: in.Type(), len: in.Len()}, true
+		}
+	}
+	return visit{}, false
+}
+
+// pathString formats the first n segments of the path, such as network.subnet[0].tags["env"].
+func (e *Encoder) pathString(n int) string {
+	if n == 0 {
+		return "<root>"
+	}
+	var b strings.Builder
+	for i, segment := range e.path[:n] {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+func indexSegment(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+func keySegment(key string) string {
+	return fmt.Sprintf("[%q]", key)
+}
@@ -0,0 +1,433 @@
+package hclencoder
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+	"reflect"
+	"strconv"
+)
+
+// Spec derives the hcldec.Spec of the body Encode writes for a struct type, decoding it into an object with an
+// attribute for each field, named after its tag. The fields of the root struct are described like those of any
+// block, except for key fields since the root block is squashed with its labels.
+//
+// Attributes are required unless they can be left out: pointers, interfaces, slices and maps without the null tag,
+// cty.Values and fields tagged omitempty, omitzero or default, the latter decoding to their default when missing.
+// Types that compute their labels with HCLLabels, blocks of interfaces or cty.Values, remain fields and recursive
+// types can't be described by a spec and return an error.
+func Spec(t reflect.Type) (hcldec.Spec, error) {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || t == ctyValueType || isNumberStruct(t) {
+		return nil, fmt.Errorf("specs can only be derived from structs, %s given", t)
+	}
+
+	b := &schemaBuilder{visiting: map[reflect.Type]bool{}}
+	spec := hcldec.ObjectSpec{}
+	if _, err := b.addFieldSpecs(spec, t, 0, true); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// BodySchema derives the hcl.BodySchema of the body Encode writes for a struct type, as implied by its Spec.
+func BodySchema(t reflect.Type) (*hcl.BodySchema, error) {
+	spec, err := Spec(t)
+	if err != nil {
+		return nil, err
+	}
+	return hcldec.ImpliedSchema(spec), nil
+}
+
+// schemaBuilder tracks the struct types being described, since a recursive type has no finite spec.
+type schemaBuilder struct {
+	visiting map[reflect.Type]bool
+}
+
+func (b *schemaBuilder) enter(t reflect.Type) (leave func(), err error) {
+	if b.visiting[t] {
+		return nil, fmt.Errorf("recursive type %s has no finite schema", t)
+	}
+	b.visiting[t] = true
+	return func() {
+		delete(b.visiting, t)
+	}, nil
+}
+
+// addFieldSpecs adds the specs of the fields of a struct type to spec, the same way encodeStruct encodes them. Key
+// fields become labels from index label on, and the index of the next label is returned.
+func (b *schemaBuilder) addFieldSpecs(spec hcldec.ObjectSpec, t reflect.Type, label int, root bool) (int, error) {
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+		meta := extractFieldMeta(field)
+		if meta.err != nil {
+			return 0, meta.err
+		}
+		if meta.unusedKeys || meta.decodedFields || meta.omit {
+			continue
+		}
+
+		switch {
+		case meta.remain:
+			return 0, fmt.Errorf("field %s: remain fields have no schema", meta.name)
+		case meta.key:
+			if !isLabelType(indirectType(field.Type)) {
+				return 0, fmt.Errorf("field %s: key fields must be strings, integers, encoding.TextMarshalers or fmt.Stringers to have a schema, %s given", meta.name, field.Type)
+			}
+			if root {
+				continue
+			}
+			spec[meta.name] = &hcldec.BlockLabelSpec{Index: label, Name: meta.name}
+			label++
+		case meta.squash:
+			squashed := indirectType(field.Type)
+			if squashed.Kind() != reflect.Struct {
+				return 0, fmt.Errorf("field %s: squash fields must be structs", meta.name)
+			}
+			leave, err := b.enter(squashed)
+			if err != nil {
+				return 0, err
+			}
+			label, err = b.addFieldSpecs(spec, squashed, label, root)
+			leave()
+			if err != nil {
+				return 0, err
+			}
+		case meta.null && isBlockField(field.Type, meta):
+			return 0, fmt.Errorf("field %s: the null tag only applies to attributes, not to blocks", meta.name)
+		default:
+			fieldSpec, err := b.fieldSpec(field.Type, meta)
+			if err != nil {
+				return 0, err
+			}
+			spec[meta.name] = fieldSpec
+		}
+	}
+	return label, nil
+}
+
+// fieldSpec describes a field that's neither a key nor squashed, as an attribute or as nested blocks.
+func (b *schemaBuilder) fieldSpec(rt reflect.Type, meta fieldMeta) (hcldec.Spec, error) {
+	t := indirectType(rt)
+	switch {
+	case t == ctyValueType:
+		if meta.block {
+			return &hcldec.BlockAttrsSpec{TypeName: meta.name, ElementType: cty.DynamicPseudoType}, nil
+		}
+		if meta.repeatBlock {
+			return nil, fmt.Errorf("field %s: cty.Value blocks have no schema", meta.name)
+		}
+	case t.Kind() == reflect.Struct && !isNumberStruct(t):
+		nested, _, err := b.blockSpec(t)
+		if err != nil {
+			return nil, err
+		}
+		return &hcldec.BlockSpec{
+			TypeName: blockTypeOf(t, meta.name),
+			Nested:   nested,
+			Required: !optionalField(rt, meta),
+		}, nil
+	case t.Kind() == reflect.Map && meta.repeatBlock:
+		return b.blockMapSpec(t, meta)
+	case t.Kind() == reflect.Map && meta.block:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("field %s: map keys must be strings, %s given", meta.name, t.Key().Kind())
+		}
+		elem, err := b.ctyType(t.Elem(), meta)
+		if err != nil {
+			return nil, err
+		}
+		return &hcldec.BlockAttrsSpec{TypeName: meta.name, ElementType: elem}, nil
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && meta.repeatBlock:
+		if elem, ok := blockListElem(t); ok {
+			return b.blockListSpec(elem, meta)
+		}
+	}
+
+	ty, err := b.ctyType(rt, meta)
+	if err != nil {
+		return nil, err
+	}
+	attr := &hcldec.AttrSpec{Name: meta.name, Type: ty, Required: !optionalField(rt, meta)}
+	if !meta.hasDefault {
+		return attr, nil
+	}
+	def, err := defaultValue(t, meta)
+	if err != nil {
+		return nil, err
+	}
+	return &hcldec.DefaultSpec{Primary: attr, Default: &hcldec.LiteralSpec{Value: def}}, nil
+}
+
+// blockSpec describes the body and labels of the block encoding a struct type, returning its number of labels.
+func (b *schemaBuilder) blockSpec(t reflect.Type) (hcldec.ObjectSpec, int, error) {
+	if implementsType(t, reflect.TypeOf((*BlockLabeler)(nil)).Elem()) {
+		return nil, 0, fmt.Errorf("%s computes its labels with HCLLabels, they have no schema", t)
+	}
+	leave, err := b.enter(t)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer leave()
+
+	spec := hcldec.ObjectSpec{}
+	labels, err := b.addFieldSpecs(spec, t, 0, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	return spec, labels, nil
+}
+
+// blockListSpec describes a block list holding structs of type elem, nested slices being flattened by the encoder.
+func (b *schemaBuilder) blockListSpec(elem reflect.Type, meta fieldMeta) (hcldec.Spec, error) {
+	if elem.Kind() == reflect.Interface {
+		return nil, fmt.Errorf("field %s: blocks of interfaces have no schema", meta.name)
+	}
+	if elem == ctyValueType {
+		return nil, fmt.Errorf("field %s: cty.Value blocks have no schema", meta.name)
+	}
+	if elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("field %s: block lists must contain structs, %s given", meta.name, elem)
+	}
+	nested, _, err := b.blockSpec(elem)
+	if err != nil {
+		return nil, err
+	}
+	return &hcldec.BlockListSpec{TypeName: blockTypeOf(elem, meta.name), Nested: nested}, nil
+}
+
+// blockMapSpec describes a map of structs, or of maps of structs, whose keys become the labels of their blocks.
+func (b *schemaBuilder) blockMapSpec(t reflect.Type, meta fieldMeta) (hcldec.Spec, error) {
+	var labelNames []string
+	for ; t.Kind() == reflect.Map; t = indirectType(t.Elem()) {
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("field %s: map keys must be strings, %s given", meta.name, t.Key().Kind())
+		}
+		labelNames = append(labelNames, mapLabelName(len(labelNames)))
+	}
+	if t.Kind() != reflect.Struct || t == ctyValueType {
+		return nil, fmt.Errorf("field %s: block maps must contain structs or maps of structs, %s given", meta.name, t)
+	}
+
+	nested, labels, err := b.blockSpec(t)
+	if err != nil {
+		return nil, err
+	}
+	// hcldec only labels the blocks of a map with its keys
+	if labels > 0 {
+		return nil, fmt.Errorf("field %s: block maps of structs with key fields have no schema", meta.name)
+	}
+	return &hcldec.BlockMapSpec{TypeName: blockTypeOf(t, meta.name), LabelNames: labelNames, Nested: nested}, nil
+}
+
+// ctyType returns the type of the attribute value tokenize writes for a Go type. Expressions can evaluate to any type.
+func (b *schemaBuilder) ctyType(rt reflect.Type, meta fieldMeta) (cty.Type, error) {
+	t := indirectType(rt)
+	switch {
+	case t == ctyValueType:
+		return cty.DynamicPseudoType, nil
+	case isNumberStruct(t) || t == jsonNumberType:
+		return cty.Number, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return cty.Bool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return cty.Number, nil
+	case reflect.String:
+		if meta.expression && !meta.literal {
+			return cty.DynamicPseudoType, nil
+		}
+		return cty.String, nil
+	case reflect.Interface:
+		return cty.DynamicPseudoType, nil
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return cty.String, nil
+		}
+		elem, err := b.ctyType(t.Elem(), meta)
+		if err != nil {
+			return cty.NilType, err
+		}
+		return cty.List(elem), nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return cty.NilType, fmt.Errorf("field %s: map keys must be strings, %s given", meta.name, t.Key().Kind())
+		}
+		elem, err := b.ctyType(t.Elem(), meta)
+		if err != nil {
+			return cty.NilType, err
+		}
+		return cty.Map(elem), nil
+	case reflect.Struct:
+		return b.objectType(t)
+	}
+	return cty.NilType, fmt.Errorf("field %s: cannot encode %s to HCL", meta.name, rt)
+}
+
+// objectType returns the type of the object a struct is tokenized into, with an optional attribute for each field that
+// can be left out. Since the entries of remain fields are only known from values, such objects can have any type.
+func (b *schemaBuilder) objectType(t reflect.Type) (cty.Type, error) {
+	leave, err := b.enter(t)
+	if err != nil {
+		return cty.NilType, err
+	}
+	defer leave()
+
+	attrs := map[string]cty.Type{}
+	var optional []string
+	remain, err := b.addObjectAttrs(attrs, &optional, t)
+	if err != nil || remain {
+		return cty.DynamicPseudoType, err
+	}
+	return cty.ObjectWithOptionalAttrs(attrs, optional), nil
+}
+
+// addObjectAttrs adds the attributes of the object of a struct type, the same way objectFields selects them,
+// reporting whether the struct has a remain field.
+func (b *schemaBuilder) addObjectAttrs(attrs map[string]cty.Type, optional *[]string, t reflect.Type) (bool, error) {
+	for _, i := range fieldOrder(t) {
+		field := t.Field(i)
+		meta := extractFieldMeta(field)
+		if meta.err != nil {
+			return false, meta.err
+		}
+		if meta.unusedKeys || meta.decodedFields || meta.omit || meta.key {
+			continue
+		}
+		if meta.remain {
+			return true, nil
+		}
+
+		if meta.squash {
+			squashed := indirectType(field.Type)
+			if squashed.Kind() != reflect.Struct {
+				return false, fmt.Errorf("field %s: squash fields must be structs", meta.name)
+			}
+			leave, err := b.enter(squashed)
+			if err != nil {
+				return false, err
+			}
+			remain, err := b.addObjectAttrs(attrs, optional, squashed)
+			leave()
+			if err != nil || remain {
+				return remain, err
+			}
+			continue
+		}
+
+		ty, err := b.ctyType(field.Type, meta)
+		if err != nil {
+			return false, err
+		}
+		attrs[meta.name] = ty
+		if optionalField(field.Type, meta) {
+			*optional = append(*optional, meta.name)
+		}
+	}
+	return false, nil
+}
+
+// optionalField reports whether a field can be left out of the output, depending on its value.
+func optionalField(t reflect.Type, meta fieldMeta) bool {
+	if meta.omitEmpty || meta.omitZero || meta.hasDefault {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return !meta.null
+	}
+	// unknown values can be omitted with OmitUnknowns
+	return t == ctyValueType
+}
+
+// defaultValue parses the default value of a primitive field declared with DefaultTag.
+func defaultValue(t reflect.Type, meta fieldMeta) (cty.Value, error) {
+	var (
+		val cty.Value
+		err error
+	)
+	switch t.Kind() {
+	case reflect.String:
+		return cty.StringVal(meta.defaultValue), nil
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(meta.defaultValue)
+		val = cty.BoolVal(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(meta.defaultValue, 0, 64)
+		val = cty.NumberIntVal(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(meta.defaultValue, 0, 64)
+		val = cty.NumberUIntVal(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(meta.defaultValue, t.Bits())
+		val = cty.NumberFloatVal(f)
+	default:
+		return cty.NilVal, fmt.Errorf("field %s: default values are only supported for primitive types, %s given", meta.name, t.Kind())
+	}
+	if err != nil {
+		return cty.NilVal, fmt.Errorf("field %s: invalid default value %q: %v", meta.name, meta.defaultValue, err)
+	}
+	return val, nil
+}
+
+// blockListElem returns the element type of a block list, looking through pointers and the nested slices the encoder
+// flattens. Lists of primitives aren't block lists, even with the blocks tag.
+func blockListElem(t reflect.Type) (reflect.Type, bool) {
+	elem := indirectType(t.Elem())
+	switch elem.Kind() {
+	case reflect.Slice, reflect.Array:
+		return blockListElem(elem)
+	case reflect.Struct, reflect.Interface, reflect.Map:
+		return elem, true
+	}
+	return nil, false
+}
+
+// blockTypeOf returns the type of the blocks encoding a struct type, asking the zero value of types implementing
+// BlockTyper.
+func blockTypeOf(t reflect.Type, name string) string {
+	return blockType(reflect.New(t).Elem(), name)
+}
+
+// isLabelType reports whether encodeLabel converts values of a type into a single label.
+func isLabelType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return implementsType(t, reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()) ||
+		implementsType(t, reflect.TypeOf((*fmt.Stringer)(nil)).Elem())
+}
+
+// implementsType reports whether a type or its pointer implements iface, like implementation does for values.
+func implementsType(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// indirectType returns the type pointers of t point to.
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// mapLabelName names the label holding the keys of a block map at the given depth.
+func mapLabelName(depth int) string {
+	if depth == 0 {
+		return "key"
+	}
+	return fmt.Sprintf("key%d", depth+1)
+}
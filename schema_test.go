@@ -0,0 +1,214 @@
+package hclencoder
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"reflect"
+	"testing"
+)
+
+type schemaPort struct {
+	Number   int    `hcl:"number"`
+	Protocol string `hcl:"protocol" hcle:"default=tcp"`
+}
+
+type schemaMount struct {
+	Source   string `hcl:",key"`
+	Target   string `hcl:",key"`
+	ReadOnly bool   `hcl:"read_only" hcle:"omitempty"`
+}
+
+type schemaVolume struct {
+	Path string `hcl:"path"`
+}
+
+type schemaMeta struct {
+	Team string `hcl:",key"`
+	Tier string `hcl:"tier"`
+}
+
+type schemaService struct {
+	Name     string            `hcl:"name"`
+	Replicas *int              `hcl:"replicas"`
+	Image    string            `hcl:"image,expr"`
+	Tags     map[string]string `hcl:"tags"`
+	Env      map[string]string `hcl:"env,block"`
+	Owner    struct {
+		Email string `hcl:"email"`
+	} `hcl:"owner"`
+	Ports   []schemaPort                       `hcl:"port,blocks"`
+	Mounts  []*schemaMount                     `hcl:"mount,blocks"`
+	Volumes map[string]map[string]schemaVolume `hcl:"volume,blocks"`
+	Checks  []struct {
+		Path     string `hcl:"path"`
+		Interval int    `hcl:"interval" hcle:"omitzero"`
+	} `hcl:"checks"`
+	Debug      []string `hcle:"omit"`
+	schemaMeta `hcl:",squash"`
+}
+
+type schemaTree struct {
+	Children []schemaTree `hcl:"child,blocks"`
+}
+
+type schemaRemain struct {
+	Extra map[string]interface{} `hcl:",remain"`
+}
+
+type schemaLabeled struct{}
+
+func (schemaLabeled) HCLLabels() []string { return nil }
+
+func TestSpecRoundTrip(t *testing.T) {
+	replicas := 3
+	service := schemaService{
+		Name:     "web",
+		Replicas: &replicas,
+		Image:    "var.image",
+		Tags:     map[string]string{"env": "prod"},
+		Env:      map[string]string{"DEBUG": "1"},
+		Ports:    []schemaPort{{Number: 80, Protocol: "tcp"}, {Number: 53, Protocol: "udp"}},
+		Mounts:   []*schemaMount{{Source: "data", Target: "/data", ReadOnly: true}},
+		Volumes: map[string]map[string]schemaVolume{
+			"disk": {"data": {Path: "/var/lib/data"}},
+		},
+		schemaMeta: schemaMeta{Team: "platform", Tier: "frontend"},
+	}
+	service.Owner.Email = "ops@example.com"
+	service.Checks = append(service.Checks, struct {
+		Path     string `hcl:"path"`
+		Interval int    `hcl:"interval" hcle:"omitzero"`
+	}{Path: "/health"})
+
+	spec, err := Spec(reflect.TypeOf(&service))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := Encode(service)
+	if !assert.NoError(t, err) {
+		return
+	}
+	file, diags := hclsyntax.ParseConfig(out, "service.hcl", hcl.InitialPos)
+	if !assert.False(t, diags.HasErrors(), diags.Error()) {
+		return
+	}
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{
+		"var": cty.ObjectVal(map[string]cty.Value{"image": cty.StringVal("nginx")}),
+	}}
+	decoded, diags := hcldec.Decode(file.Body, spec, ctx)
+	if !assert.False(t, diags.HasErrors(), diags.Error()) {
+		return
+	}
+
+	expected := cty.ObjectVal(map[string]cty.Value{
+		"name":     cty.StringVal("web"),
+		"replicas": cty.NumberIntVal(3),
+		"image":    cty.StringVal("nginx"),
+		"tags":     cty.MapVal(map[string]cty.Value{"env": cty.StringVal("prod")}),
+		"env":      cty.MapVal(map[string]cty.Value{"DEBUG": cty.StringVal("1")}),
+		"owner":    cty.ObjectVal(map[string]cty.Value{"email": cty.StringVal("ops@example.com")}),
+		"port": cty.ListVal([]cty.Value{
+			cty.ObjectVal(map[string]cty.Value{"number": cty.NumberIntVal(80), "protocol": cty.StringVal("tcp")}),
+			cty.ObjectVal(map[string]cty.Value{"number": cty.NumberIntVal(53), "protocol": cty.StringVal("udp")}),
+		}),
+		"mount": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"Source":    cty.StringVal("data"),
+			"Target":    cty.StringVal("/data"),
+			"read_only": cty.True,
+		})}),
+		"volume": cty.MapVal(map[string]cty.Value{"disk": cty.MapVal(map[string]cty.Value{
+			"data": cty.ObjectVal(map[string]cty.Value{"path": cty.StringVal("/var/lib/data")}),
+		})}),
+		"checks": cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{
+			"path":     cty.StringVal("/health"),
+			"interval": cty.NullVal(cty.Number),
+		})}),
+		"tier": cty.StringVal("frontend"),
+	})
+	assert.True(t, decoded.RawEquals(expected), "decoded %#v", decoded)
+}
+
+// TestSpecNullRoundTrip checks that null attributes and missing blocks written by Encode decode with the Spec.
+func TestSpecNullRoundTrip(t *testing.T) {
+	type config struct {
+		Limit *int                    `hcl:"limit" hcle:"null"`
+		Tags  map[string]string       `hcl:"tags" hcle:"null"`
+		Owner *struct{ Email string } `hcl:"owner"`
+		Ports []schemaPort            `hcl:"port,blocks"`
+	}
+
+	spec, err := Spec(reflect.TypeOf(config{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := Encode(config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "limit = null\ntags  = null\n", string(out))
+
+	file, diags := hclsyntax.ParseConfig(out, "config.hcl", hcl.InitialPos)
+	if !assert.False(t, diags.HasErrors(), diags.Error()) {
+		return
+	}
+	decoded, diags := hcldec.Decode(file.Body, spec, nil)
+	if assert.False(t, diags.HasErrors(), diags.Error()) {
+		assert.True(t, decoded.GetAttr("limit").IsNull())
+		assert.True(t, decoded.GetAttr("owner").IsNull())
+		assert.Equal(t, 0, decoded.GetAttr("port").LengthInt())
+	}
+}
+
+func TestBodySchema(t *testing.T) {
+	schema, err := BodySchema(reflect.TypeOf(schemaService{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ElementsMatch(t, []hcl.AttributeSchema{
+		{Name: "name", Required: true},
+		{Name: "replicas"},
+		{Name: "image", Required: true},
+		{Name: "tags"},
+		{Name: "checks"},
+		{Name: "tier", Required: true},
+	}, schema.Attributes)
+	assert.ElementsMatch(t, []hcl.BlockHeaderSchema{
+		{Type: "env"},
+		{Type: "owner"},
+		{Type: "port"},
+		{Type: "mount", LabelNames: []string{"Source", "Target"}},
+		{Type: "volume", LabelNames: []string{"key", "key2"}},
+	}, schema.Blocks)
+}
+
+func TestSpecErrors(t *testing.T) {
+	for _, in := range []interface{}{
+		"not a struct",
+		schemaTree{},
+		schemaRemain{},
+		struct {
+			Labeled schemaLabeled `hcl:"labeled"`
+		}{},
+		struct {
+			Blocks []interface{} `hcl:"block,blocks"`
+		}{},
+		struct {
+			Keyed map[string]schemaMount `hcl:"mount,blocks"`
+		}{},
+		struct {
+			Func func() `hcl:"func"`
+		}{},
+		struct {
+			Owner *struct{ Email string } `hcl:"owner" hcle:"null"`
+		}{},
+		struct {
+			Ports []schemaPort `hcl:"port,blocks" hcle:"null"`
+		}{},
+	} {
+		_, err := Spec(reflect.TypeOf(in))
+		assert.Error(t, err, "%T", in)
+	}
+}
@@ -0,0 +1,245 @@
+package hclencoder
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+	"sort"
+)
+
+// EncodeSpec converts a cty.Value into the HCL body that hcldec.Decode turns back into the same value with spec.
+func EncodeSpec(spec hcldec.Spec, val cty.Value, opts ...Option) ([]byte, error) {
+	return NewEncoder(opts...).EncodeSpec(spec, val)
+}
+
+// EncodeSpec converts a cty.Value into the HCL body that hcldec.Decode turns back into the same value with spec.
+// Attribute values are written with the encoder's ValueOptions and LiteralStrings, and blocks are laid out like those
+// of structs.
+func (e *Encoder) EncodeSpec(spec hcldec.Spec, val cty.Value) ([]byte, error) {
+	enc := *e
+	enc.path, enc.visiting = nil, nil
+
+	root := hclwrite.NewBlock("", nil)
+	if err := enc.encodeSpec(root, spec, val); err != nil {
+		return nil, err
+	}
+	enc.layout(root, nil)
+	return enc.writeFile(&node{Block: root})
+}
+
+// encodeSpec writes val into block according to spec. Specs reading from the body of the block add attributes and
+// nested blocks to it, and BlockLabelSpecs set its labels.
+func (e *Encoder) encodeSpec(block *hclwrite.Block, spec hcldec.Spec, val cty.Value) error {
+	switch s := spec.(type) {
+	case hcldec.ObjectSpec:
+		return e.encodeObjectSpec(block, s, val)
+	case hcldec.TupleSpec:
+		return e.encodeTupleSpec(block, s, val)
+	case *hcldec.AttrSpec:
+		return e.encodeAttrSpec(block, s.Name, val)
+	case *hcldec.BlockLabelSpec:
+		return e.encodeBlockLabelSpec(block, s, val)
+	case *hcldec.BlockSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, 0, nil)
+	case *hcldec.BlockListSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, 1, nil)
+	case *hcldec.BlockTupleSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, 1, nil)
+	case *hcldec.BlockSetSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, 1, nil)
+	case *hcldec.BlockMapSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, len(s.LabelNames), nil)
+	case *hcldec.BlockObjectSpec:
+		return e.appendSpecBlocks(block, s.TypeName, s.Nested, val, len(s.LabelNames), nil)
+	case *hcldec.BlockAttrsSpec:
+		return e.encodeBlockAttrsSpec(block, s, val)
+	case *hcldec.DefaultSpec:
+		// a value equal to a literal default is left out, so that the default applies
+		if literal, ok := s.Default.(*hcldec.LiteralSpec); ok && val.RawEquals(literal.Value) {
+			return nil
+		}
+		return e.encodeSpec(block, s.Primary, val)
+	case *hcldec.ValidateSpec:
+		return e.encodeSpec(block, s.Wrapped, val)
+	case *hcldec.LiteralSpec, *hcldec.ExprSpec:
+		// their values don't come from the body
+		return nil
+	case *hcldec.TransformExprSpec, *hcldec.TransformFuncSpec:
+		return fmt.Errorf("%s: transformed values can't be encoded back, %T given", e.pathString(len(e.path)), spec)
+	}
+	return fmt.Errorf("%s: unsupported spec %T", e.pathString(len(e.path)), spec)
+}
+
+// encodeObjectSpec writes each attribute of an object with its spec. The marks of the object are kept by its
+// attributes, like those of the collections of block specs are kept by their elements.
+func (e *Encoder) encodeObjectSpec(block *hclwrite.Block, spec hcldec.ObjectSpec, val cty.Value) error {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return err
+	}
+	if !val.Type().IsObjectType() {
+		return fmt.Errorf("%s: object spec needs an object, %s given", e.pathString(len(e.path)), val.Type().FriendlyName())
+	}
+
+	names := make([]string, 0, len(spec))
+	for name := range spec {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !val.Type().HasAttribute(name) {
+			return fmt.Errorf("%s: object has no attribute %q", e.pathString(len(e.path)), name)
+		}
+		if err := e.push(name); err != nil {
+			return err
+		}
+		err := e.encodeSpec(block, spec[name], val.GetAttr(name).WithMarks(marks))
+		e.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) encodeTupleSpec(block *hclwrite.Block, spec hcldec.TupleSpec, val cty.Value) error {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return err
+	}
+	if !val.Type().IsTupleType() || val.LengthInt() != len(spec) {
+		return fmt.Errorf("%s: tuple spec needs a tuple of %d elements, %s given", e.pathString(len(e.path)), len(spec), val.Type().FriendlyName())
+	}
+
+	for i, elemSpec := range spec {
+		if err := e.push(indexSegment(i)); err != nil {
+			return err
+		}
+		err := e.encodeSpec(block, elemSpec, val.Index(cty.NumberIntVal(int64(i))).WithMarks(marks))
+		e.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeAttrSpec writes an attribute, unless it's null since hcldec decodes missing attributes as null.
+func (e *Encoder) encodeAttrSpec(block *hclwrite.Block, name string, val cty.Value) error {
+	if unmarked, _ := val.Unmark(); unmarked.IsKnown() && unmarked.IsNull() {
+		return nil
+	}
+
+	// decoded strings hold no templates, so they're written as literals
+	opts := append(e.valueOptions[:len(e.valueOptions):len(e.valueOptions)], LiteralStrings())
+	str, err := ValueToString(val, opts...)
+	if err == ErrUnknownOmitted {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", e.pathString(len(e.path)), err)
+	}
+	tokens, err := tokenizeExpression(str, name)
+	if err != nil {
+		return err
+	}
+	block.Body().SetAttributeRaw(name, tokens)
+	return nil
+}
+
+func (e *Encoder) encodeBlockLabelSpec(block *hclwrite.Block, spec *hcldec.BlockLabelSpec, val cty.Value) error {
+	if val.IsMarked() {
+		return fmt.Errorf("%s: label %s can't be written from a marked value", e.pathString(len(e.path)), spec.Name)
+	}
+	if !val.IsKnown() || val.IsNull() || val.Type() != cty.String {
+		return fmt.Errorf("%s: label %s must be a known string", e.pathString(len(e.path)), spec.Name)
+	}
+
+	labels := block.Labels()
+	for len(labels) <= spec.Index {
+		labels = append(labels, "")
+	}
+	labels[spec.Index] = val.AsString()
+	block.SetLabels(labels)
+	return nil
+}
+
+// appendSpecBlocks writes a block of nested for each value found depth collections deep into val, such as 0 for a
+// BlockSpec, 1 for a BlockListSpec or the number of labels of a BlockMapSpec. The keys of maps and objects found on the
+// way become the labels of their blocks.
+func (e *Encoder) appendSpecBlocks(block *hclwrite.Block, typeName string, nested hcldec.Spec, val cty.Value, depth int, labels []string) error {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return err
+	}
+
+	if depth == 0 {
+		nestedBlock := hclwrite.NewBlock(typeName, labels)
+		if err := e.encodeSpec(nestedBlock, nested, val.WithMarks(marks)); err != nil {
+			return err
+		}
+		e.layout(nestedBlock, nil)
+		block.Body().AppendBlock(nestedBlock)
+		return nil
+	}
+
+	if !val.CanIterateElements() {
+		return fmt.Errorf("%s: %s blocks need a collection, %s given", e.pathString(len(e.path)), typeName, val.Type().FriendlyName())
+	}
+	i := 0
+	for it := val.ElementIterator(); it.Next(); i++ {
+		key, elem := it.Element()
+		elemLabels := labels
+		segment := indexSegment(i)
+		if ty := val.Type(); ty.IsMapType() || ty.IsObjectType() {
+			if len(marks) > 0 {
+				return fmt.Errorf("%s: the keys of marked maps can't be written as labels", e.pathString(len(e.path)))
+			}
+			elemLabels = append(labels[:len(labels):len(labels)], key.AsString())
+			segment = keySegment(key.AsString())
+		}
+
+		if err := e.push(segment); err != nil {
+			return err
+		}
+		err := e.appendSpecBlocks(block, typeName, nested, elem.WithMarks(marks), depth-1, elemLabels)
+		e.pop()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeBlockAttrsSpec writes a map as a block with an attribute for each of its elements.
+func (e *Encoder) encodeBlockAttrsSpec(block *hclwrite.Block, spec *hcldec.BlockAttrsSpec, val cty.Value) error {
+	val, marks := val.Unmark()
+	if ok, err := e.ctyBlockKnown(val); !ok {
+		return err
+	}
+	if len(marks) > 0 {
+		return fmt.Errorf("%s: the keys of marked maps can't be written as attribute names", e.pathString(len(e.path)))
+	}
+
+	attrsBlock := hclwrite.NewBlock(spec.TypeName, nil)
+	for it := val.ElementIterator(); it.Next(); {
+		key, elem := it.Element()
+		if !hclsyntax.ValidIdentifier(key.AsString()) {
+			return fmt.Errorf("%s: map key %q is not a valid attribute name", e.pathString(len(e.path)), key.AsString())
+		}
+		if err := e.push(keySegment(key.AsString())); err != nil {
+			return err
+		}
+		err := e.encodeAttrSpec(attrsBlock, key.AsString(), elem)
+		e.pop()
+		if err != nil {
+			return err
+		}
+	}
+	e.layout(attrsBlock, nil)
+	block.Body().AppendBlock(attrsBlock)
+	return nil
+}
@@ -0,0 +1,184 @@
+package hclencoder
+
+import (
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"io/ioutil"
+	"testing"
+)
+
+var serviceSpec = hcldec.ObjectSpec{
+	"name": &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: true},
+	"replicas": &hcldec.DefaultSpec{
+		Primary: &hcldec.AttrSpec{Name: "replicas", Type: cty.Number},
+		Default: &hcldec.LiteralSpec{Value: cty.NumberIntVal(1)},
+	},
+	"tags": &hcldec.AttrSpec{Name: "tags", Type: cty.Map(cty.String)},
+	"image": &hcldec.BlockSpec{
+		TypeName: "image",
+		Nested: hcldec.ObjectSpec{
+			"repository": &hcldec.AttrSpec{Name: "repository", Type: cty.String},
+			"tag":        &hcldec.AttrSpec{Name: "tag", Type: cty.String},
+		},
+	},
+	"ports": &hcldec.BlockListSpec{
+		TypeName: "port",
+		Nested: hcldec.ObjectSpec{
+			"number":   &hcldec.AttrSpec{Name: "number", Type: cty.Number},
+			"protocol": &hcldec.AttrSpec{Name: "protocol", Type: cty.String},
+		},
+	},
+	"volumes": &hcldec.BlockMapSpec{
+		TypeName:   "volume",
+		LabelNames: []string{"kind", "name"},
+		Nested: hcldec.ObjectSpec{
+			"path": &hcldec.AttrSpec{Name: "path", Type: cty.String},
+		},
+	},
+	"mounts": &hcldec.BlockListSpec{
+		TypeName: "mount",
+		Nested: hcldec.ObjectSpec{
+			"source": &hcldec.BlockLabelSpec{Index: 0, Name: "source"},
+			"target": &hcldec.BlockLabelSpec{Index: 1, Name: "target"},
+		},
+	},
+	"env": &hcldec.BlockAttrsSpec{TypeName: "env", ElementType: cty.String},
+}
+
+var service = cty.ObjectVal(map[string]cty.Value{
+	"name":     cty.StringVal("web"),
+	"replicas": cty.NumberIntVal(3),
+	"tags":     cty.MapVal(map[string]cty.Value{"team": cty.StringVal("platform")}),
+	"image": cty.ObjectVal(map[string]cty.Value{
+		"repository": cty.StringVal("nginx"),
+		"tag":        cty.StringVal("1.21"),
+	}),
+	"ports": cty.ListVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"number": cty.NumberIntVal(80), "protocol": cty.StringVal("tcp")}),
+		cty.ObjectVal(map[string]cty.Value{"number": cty.NumberIntVal(53), "protocol": cty.NullVal(cty.String)}),
+	}),
+	"volumes": cty.MapVal(map[string]cty.Value{
+		"disk": cty.MapVal(map[string]cty.Value{
+			"data": cty.ObjectVal(map[string]cty.Value{"path": cty.StringVal("/var/lib/data")}),
+		}),
+		"tmpfs": cty.MapVal(map[string]cty.Value{
+			"cache": cty.ObjectVal(map[string]cty.Value{"path": cty.StringVal("/var/cache")}),
+		}),
+	}),
+	"mounts": cty.ListVal([]cty.Value{
+		cty.ObjectVal(map[string]cty.Value{"source": cty.StringVal("data"), "target": cty.StringVal("/data")}),
+	}),
+	"env": cty.MapVal(map[string]cty.Value{"DEBUG": cty.StringVal("${not_a_template}")}),
+})
+
+var specTests = []struct {
+	ID      string
+	Spec    hcldec.Spec
+	Input   cty.Value
+	Options []Option
+	Output  string
+	Error   bool
+}{
+	{
+		ID:      "service",
+		Spec:    serviceSpec,
+		Input:   service,
+		Options: []Option{AttributesFirst()},
+		Output:  "spec",
+	},
+	{
+		ID: "default values are left out",
+		Spec: hcldec.ObjectSpec{
+			"replicas": serviceSpec["replicas"],
+		},
+		Input:  cty.ObjectVal(map[string]cty.Value{"replicas": cty.NumberIntVal(1)}),
+		Output: "empty",
+	},
+	{
+		ID: "blocks separated",
+		Spec: hcldec.TupleSpec{
+			&hcldec.AttrSpec{Name: "name", Type: cty.String},
+			serviceSpec["ports"],
+		},
+		Input: cty.TupleVal([]cty.Value{
+			cty.StringVal("web"),
+			service.GetAttr("ports"),
+		}),
+		Options: []Option{SeparateBlocks()},
+		Output:  "spec-separate-blocks",
+	},
+	{
+		ID:    "transformed values",
+		Spec:  &hcldec.TransformFuncSpec{Wrapped: serviceSpec["name"], Func: function.New(&function.Spec{})},
+		Input: cty.StringVal("web"),
+		Error: true,
+	},
+	{
+		ID:    "missing attribute",
+		Spec:  serviceSpec,
+		Input: cty.ObjectVal(map[string]cty.Value{"name": cty.StringVal("web")}),
+		Error: true,
+	},
+	{
+		ID:    "unknown label",
+		Spec:  serviceSpec["mounts"],
+		Input: cty.ListVal([]cty.Value{cty.ObjectVal(map[string]cty.Value{"source": cty.UnknownVal(cty.String), "target": cty.StringVal("/data")})}),
+		Error: true,
+	},
+	{
+		ID:    "marked label",
+		Spec:  serviceSpec["mounts"],
+		Input: service.GetAttr("mounts").Mark("sensitive"),
+		Error: true,
+	},
+	{
+		ID:    "invalid attribute name",
+		Spec:  serviceSpec["env"],
+		Input: cty.MapVal(map[string]cty.Value{"not valid": cty.StringVal("x")}),
+		Error: true,
+	},
+	{
+		ID:    "marked block map",
+		Spec:  serviceSpec["volumes"],
+		Input: service.GetAttr("volumes").Mark("sensitive"),
+		Error: true,
+	},
+}
+
+func TestEncodeSpecMarks(t *testing.T) {
+	actual, err := EncodeSpec(serviceSpec["image"], service.GetAttr("image").Mark("sensitive"))
+	assert.NoError(t, err)
+	assert.Equal(t, "image {\n  repository = sensitive(\"nginx\")\n  tag        = sensitive(\"1.21\")\n}\n", string(actual))
+}
+
+func TestEncodeSpec(t *testing.T) {
+	for _, test := range specTests {
+		actual, err := EncodeSpec(test.Spec, test.Input, test.Options...)
+
+		if test.Error {
+			assert.Error(t, err, test.ID)
+			continue
+		}
+		expected, ferr := ioutil.ReadFile(fmt.Sprintf("_tests/%s.hcl", test.Output))
+		if ferr != nil {
+			t.Fatal(test.ID, "- could not read output HCL: ", ferr)
+		}
+		assert.NoError(t, err, test.ID)
+		assert.EqualValues(t, string(expected), string(actual), test.ID)
+
+		// the encoded body decodes back into the input
+		file, diags := hclsyntax.ParseConfig(actual, test.Output+".hcl", hcl.InitialPos)
+		if !assert.False(t, diags.HasErrors(), "%s: %v", test.ID, diags) {
+			continue
+		}
+		decoded, diags := hcldec.Decode(file.Body, test.Spec, nil)
+		if assert.False(t, diags.HasErrors(), "%s: %v", test.ID, diags) {
+			assert.True(t, decoded.RawEquals(test.Input), "%s: decoded %#v", test.ID, decoded)
+		}
+	}
+}
@@ -1,17 +1,33 @@
 package hclencoder
 
 import (
+	"errors"
 	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 	"github.com/zclconf/go-cty/cty/json"
+	"sort"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
-// EscapeString escapes a string so that it can be used in HCL. It doesn't escape anything inside a template
-// expression (${...})
+// EscapeString escapes a string so that it can be used in HCL, keeping its template sequences like EscapeTemplate
+// does. A string that isn't a valid template is escaped as before EscapeTemplate existed: everything is escaped but
+// the interpolations (${...}) found, which are kept as they are and can leave the quoted string invalid.
+//
+// Deprecated: EscapeString can't report invalid templates. Use EscapeTemplate, which returns an error for them, or
+// EscapeLiteral to escape template sequences too.
 func EscapeString(s string) string {
+	if escaped, err := EscapeTemplate(s); err == nil {
+		return escaped
+	}
+	return escapeInterpolations(s)
+}
+
+// escapeInterpolations escapes everything but the interpolations (${...}) of a string, without checking them.
+func escapeInterpolations(s string) string {
 	var result []byte
 	stack := []string{""}
 	escapeNext := false
@@ -50,6 +66,54 @@ func EscapeString(s string) string {
 	return string(result)
 }
 
+// EscapeTemplate escapes a template so that it can be used as a quoted HCL string. Only its literal parts are escaped:
+// interpolations (${...}), directives (%{...}), their strip markers (~) and template escapes ($${ and %%{) are kept as
+// they are, so the quoted string evaluates exactly like the template. Invalid templates are reported as errors.
+func EscapeTemplate(s string) (string, error) {
+	src := []byte(s)
+	if _, diags := hclsyntax.ParseTemplate(src, "", hcl.InitialPos); diags.HasErrors() {
+		return "", fmt.Errorf("invalid template %q: %v", s, diags.Error())
+	}
+	tokens, _ := hclsyntax.LexTemplate(src, "", hcl.InitialPos)
+
+	var result []byte
+	depth, end := 0, 0
+	for _, token := range tokens {
+		// spaces between the tokens of a sequence are kept as they are
+		result = append(result, src[end:token.Range.Start.Byte]...)
+		end = token.Range.End.Byte
+
+		switch token.Type {
+		case hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+			depth++
+		case hclsyntax.TokenTemplateSeqEnd:
+			depth--
+		case hclsyntax.TokenStringLit:
+			if depth == 0 {
+				for _, r := range string(token.Bytes) {
+					result = escapeAndAppend(result, r, true)
+				}
+				continue
+			}
+		}
+		result = append(result, token.Bytes...)
+	}
+	return string(result), nil
+}
+
+// EscapeLiteral escapes a string so that it can be used in HCL as is. Unlike EscapeTemplate, template sequences are
+// escaped too, ${ becoming $${ and %{ becoming %%{, so the string is never interpreted as a template.
+func EscapeLiteral(s string) string {
+	var result []byte
+	for i, c := range s {
+		result = escapeAndAppend(result, c, true)
+		if (c == '$' || c == '%') && i < len(s)-1 && s[i+1] == '{' {
+			result = append(result, byte(c))
+		}
+	}
+	return string(result)
+}
+
 func escapeAndAppend(buf []byte, r rune, escapeQuote bool) []byte {
 	switch r {
 	case '\n':
@@ -71,7 +135,7 @@ func escapeAndAppend(buf []byte, r rune, escapeQuote bool) []byte {
 			if r < 65536 {
 				buf = append(buf, fmt.Sprintf("\\u%04x", r)...)
 			} else {
-				buf = append(buf, fmt.Sprintf("\\u%08x", r)...)
+				buf = append(buf, fmt.Sprintf("\\U%08x", r)...)
 			}
 		} else {
 			buf = utf8.AppendRune(buf, r)
@@ -80,53 +144,180 @@ func escapeAndAppend(buf []byte, r rune, escapeQuote bool) []byte {
 	return buf
 }
 
-// ValueToString converts a cty.Value into its HCL representation
-func ValueToString(val cty.Value) (string, error) {
+// ValueOption configures how ValueToString renders a cty.Value.
+type ValueOption func(*valueFormat)
+
+type valueFormat struct {
+	literal            bool
+	preserveTypes      bool
+	markFunctions      map[interface{}]string
+	omitUnknowns       bool
+	unknownPlaceholder string
+}
+
+// ErrUnknownOmitted is returned by ValueToString for an unknown value left out with OmitUnknowns.
+var ErrUnknownOmitted = errors.New("unknown value omitted")
+
+// LiteralStrings escapes strings with EscapeLiteral rather than EscapeTemplate, so they can never be interpreted as
+// templates.
+func LiteralStrings() ValueOption {
+	return func(f *valueFormat) {
+		f.literal = true
+	}
+}
+
+// PreserveTypes wraps lists, sets and maps in tolist(), toset() and tomap() calls. Otherwise they're written as tuples
+// and objects, the types HCL gives to [...] and {...} when the result is evaluated again.
+func PreserveTypes() ValueOption {
+	return func(f *valueFormat) {
+		f.preserveTypes = true
+	}
+}
+
+// MarkFunction wraps values marked with mark in a call to function, such as sensitive(...). Values marked with the
+// string "sensitive" are wrapped in sensitive() by default, and other marks are dropped.
+func MarkFunction(mark interface{}, function string) ValueOption {
+	return func(f *valueFormat) {
+		f.markFunctions[mark] = function
+	}
+}
+
+// UnknownPlaceholder writes unknown values as expr, instead of failing on them.
+func UnknownPlaceholder(expr string) ValueOption {
+	return func(f *valueFormat) {
+		f.unknownPlaceholder = expr
+	}
+}
+
+// OmitUnknowns leaves unknown values out of their collections, instead of failing on them. An unknown value that
+// isn't in a collection makes ValueToString return ErrUnknownOmitted.
+func OmitUnknowns() ValueOption {
+	return func(f *valueFormat) {
+		f.omitUnknowns = true
+	}
+}
+
+// ValueToString converts a cty.Value into its HCL representation. The elements of sets are sorted by their
+// representation, so that sets are always written the same way.
+func ValueToString(val cty.Value, opts ...ValueOption) (string, error) {
+	return newValueFormat(opts...).valueToString(val)
+}
+
+func newValueFormat(opts ...ValueOption) valueFormat {
+	format := valueFormat{markFunctions: map[interface{}]string{"sensitive": "sensitive"}}
+	for _, opt := range opts {
+		opt(&format)
+	}
+	return format
+}
+
+func (f valueFormat) valueToString(val cty.Value) (string, error) {
+	val, marks := val.Unmark()
+	str, err := f.unmarkedToString(val)
+	if err != nil {
+		return "", err
+	}
+
+	var functions []string
+	for mark := range marks {
+		if function, ok := f.markFunctions[mark]; ok {
+			functions = append(functions, function)
+		}
+	}
+	sort.Strings(functions)
+	for _, function := range functions {
+		str = fmt.Sprintf("%s(%s)", function, str)
+	}
+	return str, nil
+}
+
+func (f valueFormat) unmarkedToString(val cty.Value) (string, error) {
 	if !val.IsKnown() {
+		switch {
+		case f.omitUnknowns:
+			return "", ErrUnknownOmitted
+		case f.unknownPlaceholder != "":
+			return f.unknownPlaceholder, nil
+		}
 		return "", fmt.Errorf("can't stringify unknown values")
 	}
 	if val.IsNull() {
 		return "null", nil
 	}
-	var err error
-	if val.Type().IsListType() || val.Type().IsTupleType() || val.Type().IsSetType() {
+
+	ty := val.Type()
+	switch {
+	case ty.IsListType() || ty.IsTupleType() || ty.IsSetType():
 		var elems []string
-		val.ForEachElement(func(_ cty.Value, val cty.Value) (stop bool) {
-			innerVal, err := ValueToString(val)
+		for it := val.ElementIterator(); it.Next(); {
+			_, elem := it.Element()
+			elemStr, err := f.valueToString(elem)
+			if err == ErrUnknownOmitted {
+				continue
+			}
 			if err != nil {
-				return true
+				return "", err
 			}
-
-			elems = append(elems, innerVal)
-			return false
-		})
-		if err != nil {
-			return "", err
+			elems = append(elems, elemStr)
 		}
-		return fmt.Sprintf("[%s]", strings.Join(elems, ",")), nil
-	} else if val.Type().IsMapType() || val.Type().IsObjectType() {
+		if ty.IsSetType() {
+			sort.Strings(elems)
+		}
+		return f.convert(ty, fmt.Sprintf("[%s]", strings.Join(elems, ","))), nil
+	case ty.IsMapType() || ty.IsObjectType():
 		var elems []string
-		val.ForEachElement(func(key cty.Value, val cty.Value) (stop bool) {
-			keyStr, err := ValueToString(key)
+		for it := val.ElementIterator(); it.Next(); {
+			key, elem := it.Element()
+			keyStr, err := f.valueToString(key)
 			if err != nil {
-				return true
+				return "", err
+			}
+			elemStr, err := f.valueToString(elem)
+			if err == ErrUnknownOmitted {
+				continue
 			}
-			valStr, err := ValueToString(val)
 			if err != nil {
-				return true
+				return "", err
 			}
-			elems = append(elems, fmt.Sprintf("%s=%s", keyStr, valStr))
-			return false
-		})
-		return fmt.Sprintf("{%s}", strings.Join(elems, ",")), nil
-	} else if val.Type() == cty.String {
-		return fmt.Sprintf(`"%s"`, EscapeString(val.AsString())), nil
-	} else {
+			elems = append(elems, fmt.Sprintf("%s=%s", keyStr, elemStr))
+		}
+		return f.convert(ty, fmt.Sprintf("{%s}", strings.Join(elems, ","))), nil
+	case ty == cty.String:
+		if f.literal {
+			return fmt.Sprintf(`"%s"`, EscapeLiteral(val.AsString())), nil
+		}
+		escaped, err := EscapeTemplate(val.AsString())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`"%s"`, escaped), nil
+	case ty == cty.Number:
+		bf := val.AsBigFloat()
+		if bf.IsInf() {
+			return "", fmt.Errorf("can't stringify infinite numbers")
+		}
+		return bf.Text('f', -1), nil
+	default:
 		bytes, err := json.SimpleJSONValue{Value: val}.MarshalJSON()
 		if err != nil {
-			return "", fmt.Errorf("unable to marshal value of type %s: %s", val.Type().FriendlyName(), err.Error())
+			return "", fmt.Errorf("unable to marshal value of type %s: %s", ty.FriendlyName(), err.Error())
 		}
 		return string(bytes), nil
 	}
+}
 
+// convert wraps a collection written as a tuple or an object into the function converting it back to its type.
+func (f valueFormat) convert(ty cty.Type, collection string) string {
+	if !f.preserveTypes {
+		return collection
+	}
+	switch {
+	case ty.IsListType():
+		return fmt.Sprintf("tolist(%s)", collection)
+	case ty.IsSetType():
+		return fmt.Sprintf("toset(%s)", collection)
+	case ty.IsMapType():
+		return fmt.Sprintf("tomap(%s)", collection)
+	}
+	return collection
 }
@@ -1,7 +1,12 @@
 package hclencoder
 
 import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/stretchr/testify/assert"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
 	"testing"
 )
 
@@ -16,15 +21,207 @@ var stringTests = []struct {
 	{"\"", "\\\""},
 	{"${\"test\"}", "${\"test\"}"},
 	{"\"${\"test\"}\"", "\\\"${\"test\"}\\\""},
+	{"${file(\"\\n\")}", "${file(\"\\n\")}"},
+	{"${\"${\"\\\"\"} \\n \"}\n", "${\"${\"\\\"\"} \\n \"}\\n"},
+	{"%{ if x }\"yes\"%{ else }no%{ endif }", "%{ if x }\\\"yes\\\"%{ else }no%{ endif }"},
+	{"a ${~ x ~} b", "a ${~ x ~} b"},
+	{"$${x} $$${x} %%{x}", "$${x} $$${x} %%{x}"},
+	{"${ {a = \"}\"}.a }", "${ {a = \"}\"}.a }"},
+	{"%{ for i in items }${i},%{ endfor ~}\n", "%{ for i in items }${i},%{ endfor ~}\\n"},
+	{"${\n  x\n}", "${\n  x\n}"},
+	{"\U000e0001\u0080", "\\U000e0001\\u0080"},
+}
+
+// legacyStrings aren't valid templates, so EscapeString escapes them as it did before EscapeTemplate existed.
+var legacyStrings = []struct {
+	input    string
+	expected string
+}{
 	{"${\"\\ \"\"}", "${\"\\ \"\"}"},
 	{"${\"\n\"}", "${\"\n\"}"},
 	{"${\"}\\\"}", "${\"}\\\"}"},
 	{"${\"${\" \n \"} \n \"}", "${\"${\" \n \"} \n \"}"},
-	{"${file(\"\\n\")}", "${file(\"\\n\")}"},
+}
+
+// invalidTemplates can't be escaped by EscapeTemplate, while EscapeLiteral escapes their template sequences.
+var invalidTemplates = []struct {
+	input    string
+	expected string
+}{
+	{"${\"\\ \"\"}", "$${\\\"\\\\ \\\"\\\"}"},
+	{"${\"\n\"}", "$${\\\"\\n\\\"}"},
+	{"${\"}\\\"}", "$${\\\"}\\\\\\\"}"},
+	{"%{ if x }", "%%{ if x }"},
+	{"${", "$${"},
 }
 
 func TestStrings(t *testing.T) {
 	for _, tt := range stringTests {
 		assert.Equal(t, tt.expected, EscapeString(tt.input))
 	}
+	for _, tt := range legacyStrings {
+		assert.Equal(t, tt.expected, EscapeString(tt.input))
+	}
+	for _, tt := range invalidTemplates {
+		assert.Equal(t, tt.expected, EscapeLiteral(tt.input))
+		_, err := EscapeTemplate(tt.input)
+		assert.Error(t, err, tt.input)
+	}
+}
+
+// TestEscapeTemplate checks that quoted templates evaluate like the templates they were escaped from.
+func TestEscapeTemplate(t *testing.T) {
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"x":     cty.True,
+			"items": cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		},
+	}
+	for _, tt := range stringTests {
+		template, diags := hclsyntax.ParseTemplate([]byte(tt.input), "", hcl.InitialPos)
+		if !assert.False(t, diags.HasErrors(), tt.input) {
+			continue
+		}
+		escaped, err := EscapeTemplate(tt.input)
+		if !assert.NoError(t, err, tt.input) {
+			continue
+		}
+		quoted, diags := hclsyntax.ParseExpression([]byte(`"`+escaped+`"`), "", hcl.InitialPos)
+		if !assert.False(t, diags.HasErrors(), escaped) {
+			continue
+		}
+
+		expected, _ := template.Value(ctx)
+		actual, _ := quoted.Value(ctx)
+		assert.True(t, expected.RawEquals(actual), "%s: %#v != %#v", tt.input, expected, actual)
+	}
+}
+
+var literalTests = []string{
+	"password",
+	"pa${ss}word",
+	"pa%{ if true }ss%{ endif }word",
+	"$${escaped}",
+	"$$${escaped}",
+	"${",
+	"\"quoted\"\n\t\\",
+}
+
+func TestEscapeLiteral(t *testing.T) {
+	for _, s := range literalTests {
+		expr, diags := hclsyntax.ParseExpression([]byte(`"`+EscapeLiteral(s)+`"`), "", hcl.InitialPos)
+		if !assert.False(t, diags.HasErrors(), s) {
+			continue
+		}
+		val, diags := expr.Value(nil)
+		assert.False(t, diags.HasErrors(), s)
+		assert.Equal(t, s, val.AsString())
+	}
+}
+
+var valueTests = []struct {
+	value     cty.Value
+	expected  string // without PreserveTypes
+	preserved string // with PreserveTypes
+}{
+	{
+		cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		`["a","b"]`,
+		`tolist(["a","b"])`,
+	},
+	{
+		cty.SetVal([]cty.Value{cty.StringVal("b"), cty.StringVal("a"), cty.StringVal("c")}),
+		`["a","b","c"]`,
+		`toset(["a","b","c"])`,
+	},
+	{
+		cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.NumberIntVal(1)}),
+		`["a",1]`,
+		`["a",1]`,
+	},
+	{
+		cty.MapVal(map[string]cty.Value{"b": cty.NumberIntVal(2), "a": cty.NumberIntVal(1)}),
+		`{"a"=1,"b"=2}`,
+		`tomap({"a"=1,"b"=2})`,
+	},
+	{
+		cty.ObjectVal(map[string]cty.Value{
+			"list": cty.ListVal([]cty.Value{cty.MapVal(map[string]cty.Value{"a": cty.True})}),
+			"set":  cty.SetVal([]cty.Value{cty.NumberIntVal(10), cty.NumberIntVal(9)}),
+		}),
+		`{"list"=[{"a"=true}],"set"=[10,9]}`,
+		`{"list"=tolist([tomap({"a"=true})]),"set"=toset([10,9])}`,
+	},
+}
+
+func TestValueToString(t *testing.T) {
+	ctx := &hcl.EvalContext{
+		Functions: map[string]function.Function{
+			"tolist": conversion(cty.List(cty.DynamicPseudoType)),
+			"toset":  conversion(cty.Set(cty.DynamicPseudoType)),
+			"tomap":  conversion(cty.Map(cty.DynamicPseudoType)),
+		},
+	}
+
+	for _, tt := range valueTests {
+		actual, err := ValueToString(tt.value)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, actual)
+
+		preserved, err := ValueToString(tt.value, PreserveTypes())
+		assert.NoError(t, err)
+		assert.Equal(t, tt.preserved, preserved)
+
+		expr, diags := hclsyntax.ParseExpression([]byte(preserved), "", hcl.InitialPos)
+		if !assert.False(t, diags.HasErrors(), preserved) {
+			continue
+		}
+		val, diags := expr.Value(ctx)
+		assert.False(t, diags.HasErrors(), preserved)
+		assert.True(t, tt.value.RawEquals(val), "%s evaluates to %#v", preserved, val)
+	}
+
+	_, err := ValueToString(cty.ListVal([]cty.Value{cty.StringVal("${")}))
+	assert.Error(t, err, "errors of elements are returned")
+}
+
+// conversion returns a function converting its argument to ty, like Terraform's tolist, toset and tomap.
+func conversion(ty cty.Type) function.Function {
+	return function.New(&function.Spec{
+		Params: []function.Parameter{{Name: "v", Type: cty.DynamicPseudoType}},
+		Type: func(args []cty.Value) (cty.Type, error) {
+			converted, err := convert.Convert(args[0], ty)
+			if err != nil {
+				return cty.NilType, err
+			}
+			return converted.Type(), nil
+		},
+		Impl: func(args []cty.Value, _ cty.Type) (cty.Value, error) {
+			return convert.Convert(args[0], ty)
+		},
+	})
+}
+
+type testMark string
+
+func TestValueToStringMarksAndUnknowns(t *testing.T) {
+	val := cty.ObjectVal(map[string]cty.Value{
+		"password": cty.StringVal("secret").Mark("sensitive"),
+		"id":       cty.UnknownVal(cty.String),
+		"tags":     cty.ListVal([]cty.Value{cty.StringVal("a"), cty.UnknownVal(cty.String)}).Mark(testMark("custom")),
+	})
+
+	_, err := ValueToString(val)
+	assert.Error(t, err, "unknown values fail by default")
+
+	actual, err := ValueToString(val, UnknownPlaceholder("null"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id"=null,"password"=sensitive("secret"),"tags"=["a",null]}`, actual)
+
+	actual, err = ValueToString(val, OmitUnknowns(), MarkFunction(testMark("custom"), "nonsensitive"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"password"=sensitive("secret"),"tags"=nonsensitive(["a"])}`, actual)
+
+	_, err = ValueToString(cty.UnknownVal(cty.String), OmitUnknowns())
+	assert.Equal(t, ErrUnknownOmitted, err)
 }
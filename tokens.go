@@ -1,107 +1,82 @@
 package hclencoder
 
 import (
+	"errors"
 	"fmt"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 	"reflect"
-	"sort"
 )
 
 // tokenize converts a primitive type into tokens. structs and maps are converted into objects and slices are converted
 // into tuples.
-func tokenize(in reflect.Value, meta fieldMeta) (tkns hclwrite.Tokens, err error) {
+func (e *Encoder) tokenize(in reflect.Value, meta fieldMeta) (tkns hclwrite.Tokens, err error) {
 
-	tokenEqual := hclwrite.Token{
-		Type:         hclsyntax.TokenEqual,
-		Bytes:        []byte("="),
-		SpacesBefore: 0,
-	}
 	tokenComma := hclwrite.Token{
 		Type:         hclsyntax.TokenComma,
 		Bytes:        []byte(","),
 		SpacesBefore: 0,
 	}
-	tokenOCurlyBrace := hclwrite.Token{
-		Type:         hclsyntax.TokenOBrace,
-		Bytes:        []byte("{"),
-		SpacesBefore: 0,
-	}
-	tokenCCurlyBrace := hclwrite.Token{
-		Type:         hclsyntax.TokenCBrace,
-		Bytes:        []byte("}"),
-		SpacesBefore: 0,
+
+	leave, err := e.enter(in)
+	if err != nil {
+		return nil, err
 	}
+	defer leave()
 
 	switch in.Kind() {
 	case reflect.Bool:
 		return hclwrite.TokensForValue(cty.BoolVal(in.Bool())), nil
 
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		return hclwrite.TokensForValue(cty.NumberUIntVal(in.Uint())), nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		return hclwrite.TokensForValue(cty.NumberIntVal(in.Int())), nil
 
-	case reflect.Float64:
-		return hclwrite.TokensForValue(cty.NumberFloatVal(in.Float())), nil
+	case reflect.Float32, reflect.Float64:
+		return e.tokenizeFloat(in)
 	case reflect.String:
+		if in.Type() == jsonNumberType {
+			return e.tokenizeJSONNumber(in)
+		}
 		val := in.String()
-		if !meta.expression {
+		// hclwrite escapes template sequences of string literals already
+		if !meta.expression || meta.literal {
 			return hclwrite.TokensForValue(cty.StringVal(val)), nil
 		}
-		// Unfortunately hcl escapes template expressions (${...}) when using hclwrite.TokensForValue. So we escape
-		// everything but template expressions and then parse the expression into tokens.
-		tokens, diags := hclsyntax.LexExpression([]byte(val), meta.name, hcl.Pos{
-			Line:   0,
-			Column: 0,
-			Byte:   0,
-		})
-
-		if diags != nil {
-			return nil, fmt.Errorf("error when parsing string %s: %v", val, diags.Error())
-		}
-		return convertTokens(tokens), nil
+		return tokenizeExpression(val, meta.name)
 	case reflect.Pointer, reflect.Interface:
-		val, isNil := deref(in)
-		if isNil {
-			return nil, nil
+		val, isNil, err := e.deref(in)
+		if err != nil || isNil {
+			return nil, err
 		}
-		return tokenize(val, meta)
+		return e.tokenize(val, meta)
 	case reflect.Struct:
-		var tokens []*hclwrite.Token
-		tokens = append(tokens, &tokenOCurlyBrace)
-		for i := 0; i < in.NumField(); i++ {
-			field := in.Type().Field(i)
-			meta := extractFieldMeta(field)
-
-			rawVal := in.Field(i)
-			if meta.omitEmpty {
-				zeroVal := reflect.Zero(rawVal.Type()).Interface()
-				if reflect.DeepEqual(rawVal.Interface(), zeroVal) {
-					continue
-				}
+		if in.Type() == ctyValueType {
+			str, err := ValueToString(in.Interface().(cty.Value), e.ctyValueOptions(meta)...)
+			if err == ErrUnknownOmitted {
+				return nil, nil
 			}
-			val, err := tokenize(rawVal, meta)
 			if err != nil {
-				return nil, err
-			}
-			for _, tkn := range hclwrite.TokensForValue(cty.StringVal(meta.name)) {
-				tokens = append(tokens, tkn)
-			}
-			tokens = append(tokens, &tokenEqual)
-			for _, tkn := range val {
-				tokens = append(tokens, tkn)
-			}
-			if i < in.NumField()-1 {
-				tokens = append(tokens, &tokenComma)
+				return nil, fmt.Errorf("%s: %v", e.pathString(len(e.path)), err)
 			}
+			return tokenizeExpression(str, meta.name)
+		}
+		if isNumberStruct(in.Type()) {
+			return e.tokenizeBigNumber(in)
+		}
+		keys, values, err := e.objectFields(in, fieldNames(in.Type()))
+		if err != nil {
+			return nil, err
+		}
+		return tokenizeObject(keys, values), nil
+	case reflect.Slice, reflect.Array:
+		if in.Kind() == reflect.Slice && in.Type().Elem().Kind() == reflect.Uint8 {
+			return e.tokenizeBytes(in, meta)
 		}
-		tokens = append(tokens, &tokenCCurlyBrace)
-		return tokens, nil
-	case reflect.Slice:
 		var tokens []*hclwrite.Token
 		tokens = append(tokens, &hclwrite.Token{
 			Type:         hclsyntax.TokenOBrace,
@@ -109,10 +84,18 @@ func tokenize(in reflect.Value, meta fieldMeta) (tkns hclwrite.Tokens, err error
 			SpacesBefore: 0,
 		})
 		for i := 0; i < in.Len(); i++ {
-			value, err := tokenize(in.Index(i), meta)
+			if err := e.push(indexSegment(i)); err != nil {
+				return nil, err
+			}
+			value, err := e.tokenize(in.Index(i), meta)
+			e.pop()
 			if err != nil {
 				return nil, err
 			}
+			if value == nil {
+				// nil elements keep their position in the tuple
+				value = hclwrite.TokensForValue(cty.NullVal(cty.DynamicPseudoType))
+			}
 			for _, tkn := range value {
 				tokens = append(tokens, tkn)
 			}
@@ -130,35 +113,166 @@ func tokenize(in reflect.Value, meta fieldMeta) (tkns hclwrite.Tokens, err error
 		if keyType := in.Type().Key().Kind(); keyType != reflect.String {
 			return nil, fmt.Errorf("map keys must be strings, %s given", keyType)
 		}
-		var tokens []*hclwrite.Token
-		tokens = append(tokens, &tokenOCurlyBrace)
-
 		var keys []string
-		for _, k := range in.MapKeys() {
+		var values []hclwrite.Tokens
+		for _, k := range sortedMapKeys(in) {
+			if err := e.push(keySegment(k.String())); err != nil {
+				return nil, err
+			}
+			val, err := e.tokenize(in.MapIndex(k), meta)
+			e.pop()
+			if err != nil {
+				return nil, err
+			}
+			if val == nil {
+				continue
+			}
 			keys = append(keys, k.String())
+			values = append(values, val)
 		}
-		sort.Strings(keys)
-		for i, k := range keys {
-			val, err := tokenize(in.MapIndex(reflect.ValueOf(k)), meta)
+		return tokenizeObject(keys, values), nil
+	}
+
+	return nil, e.unsupportedKind(in)
+}
+
+// objectFields selects the fields of a struct encoded as an object, the same way encodeStruct does for blocks. Key
+// fields are left out since objects have no labels, and squashed structs are lifted into the object. Remain keys are
+// checked against fields, the names of the fields of the outermost struct.
+func (e *Encoder) objectFields(in reflect.Value, fields map[string]string) (keys []string, values []hclwrite.Tokens, err error) {
+	for _, i := range fieldOrder(in.Type()) {
+		field := in.Type().Field(i)
+		meta := extractFieldMeta(field)
+
+		rawVal := in.Field(i)
+		skip, err := skipField(rawVal, meta)
+		if err != nil {
+			return nil, nil, err
+		}
+		if skip || meta.key {
+			continue
+		}
+
+		val, isNil, err := e.deref(rawVal)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isNil {
+			if meta.null {
+				keys = append(keys, meta.name)
+				values = append(values, hclwrite.TokensForValue(cty.NullVal(cty.DynamicPseudoType)))
+			}
+			continue
+		}
+
+		if meta.remain {
+			names, remainValues, err := e.remainEntries(val)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			for _, tkn := range hclwrite.TokensForValue(cty.StringVal(k)) {
-				tokens = append(tokens, tkn)
+			for j, name := range names {
+				if field, ok := fields[name]; ok {
+					return nil, nil, fmt.Errorf("remain key %q collides with field %s", name, field)
+				}
+				// remain keys of squashed structs have already been added
+				for _, k := range keys {
+					if k == name {
+						return nil, nil, fmt.Errorf("remain key %q collides with an attribute or block", name)
+					}
+				}
+				tkns, ok, err := e.tokenizeEntry(name, remainValues[j], meta)
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					keys = append(keys, name)
+					values = append(values, tkns)
+				}
 			}
-			tokens = append(tokens, &tokenEqual)
-			for _, tkn := range val {
-				tokens = append(tokens, tkn)
+			continue
+		}
+
+		if meta.squash {
+			if val.Kind() != reflect.Struct {
+				return nil, nil, errors.New("squash fields must be structs")
 			}
-			if i < len(keys)-1 {
-				tokens = append(tokens, &tokenComma)
+			if err := e.push(meta.name); err != nil {
+				return nil, nil, err
 			}
+			squashedKeys, squashedValues, err := e.objectFields(val, fields)
+			e.pop()
+			if err != nil {
+				return nil, nil, err
+			}
+			keys = append(keys, squashedKeys...)
+			values = append(values, squashedValues...)
+			continue
+		}
+
+		tkns, ok, err := e.tokenizeEntry(meta.name, val, meta)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			keys = append(keys, meta.name)
+			values = append(values, tkns)
 		}
-		tokens = append(tokens, &tokenCCurlyBrace)
-		return tokens, nil
 	}
+	return keys, values, nil
+}
 
-	return nil, fmt.Errorf("cannot encode primitive kind %s to token", in.Kind())
+// tokenizeEntry tokenizes the value of a field or map entry under the path segment of its name. Unknown values omitted
+// with OmitUnknowns have no tokens, so ok is false and the entry is left out.
+func (e *Encoder) tokenizeEntry(segment string, in reflect.Value, meta fieldMeta) (tkns hclwrite.Tokens, ok bool, err error) {
+	if err := e.push(segment); err != nil {
+		return nil, false, err
+	}
+	defer e.pop()
+
+	tkns, err = e.tokenize(in, meta)
+	return tkns, err == nil && tkns != nil, err
+}
+
+// tokenizeObject converts keys and their values into the tokens of an object.
+func tokenizeObject(keys []string, values []hclwrite.Tokens) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{{
+		Type:  hclsyntax.TokenOBrace,
+		Bytes: []byte("{"),
+	}}
+	for i, k := range keys {
+		if i > 0 {
+			tokens = append(tokens, &hclwrite.Token{
+				Type:  hclsyntax.TokenComma,
+				Bytes: []byte(","),
+			})
+		}
+		tokens = append(tokens, hclwrite.TokensForValue(cty.StringVal(k))...)
+		tokens = append(tokens, &hclwrite.Token{
+			Type:  hclsyntax.TokenEqual,
+			Bytes: []byte("="),
+		})
+		tokens = append(tokens, values[i]...)
+	}
+	return append(tokens, &hclwrite.Token{
+		Type:  hclsyntax.TokenCBrace,
+		Bytes: []byte("}"),
+	})
+}
+
+// tokenizeExpression lexes an expression into tokens, leaving it unquoted.
+func tokenizeExpression(val string, filename string) (hclwrite.Tokens, error) {
+	// Unfortunately hcl escapes template expressions (${...}) when using hclwrite.TokensForValue. So we escape
+	// everything but template expressions and then parse the expression into tokens.
+	tokens, diags := hclsyntax.LexExpression([]byte(val), filename, hcl.Pos{
+		Line:   0,
+		Column: 0,
+		Byte:   0,
+	})
+
+	if diags != nil {
+		return nil, fmt.Errorf("error when parsing string %s: %v", val, diags.Error())
+	}
+	return convertTokens(tokens), nil
 }
 
 func convertTokens(tokens hclsyntax.Tokens) hclwrite.Tokens {